@@ -0,0 +1,69 @@
+package apilogger
+
+import "context"
+
+// contextKey is the type of the context keys of the package,
+// so its values never collide with those set by other packages
+// with the same names.
+type contextKey int
+
+const (
+	apiKeyKey contextKey = iota
+	requestIDKey
+	remoteAddrKey
+	sessionIDKey
+)
+
+// WithAPIKey returns a copy of ctx carrying the api-key of the request.
+func WithAPIKey(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, apiKeyKey, apiKey)
+}
+
+// APIKeyFrom returns the api-key set on ctx by WithAPIKey,
+// or with the deprecated APIKEY key.
+func APIKeyFrom(ctx context.Context) string {
+	return stringValue(ctx, apiKeyKey, APIKEY)
+}
+
+// WithRequestID returns a copy of ctx carrying the id of the request.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFrom returns the request id set on ctx by
+// WithRequestID, or with the deprecated RequestIDKey key.
+func RequestIDFrom(ctx context.Context) string {
+	return stringValue(ctx, requestIDKey, RequestIDKey)
+}
+
+// WithRemoteAddr returns a copy of ctx carrying the address of the client.
+func WithRemoteAddr(ctx context.Context, remoteAddr string) context.Context {
+	return context.WithValue(ctx, remoteAddrKey, remoteAddr)
+}
+
+// RemoteAddrFrom returns the client address set on ctx by
+// WithRemoteAddr, or with the deprecated RemoteAddrKey key.
+func RemoteAddrFrom(ctx context.Context) string {
+	return stringValue(ctx, remoteAddrKey, RemoteAddrKey)
+}
+
+// WithSessionID returns a copy of ctx carrying the session id of the request.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionIDFrom returns the session id set on ctx by
+// WithSessionID, or with the deprecated SessionIDKey key.
+func SessionIDFrom(ctx context.Context) string {
+	return stringValue(ctx, sessionIDKey, SessionIDKey)
+}
+
+// stringValue returns the value of key in ctx, falling back to
+// the value of its legacy string key while callers migrate.
+func stringValue(ctx context.Context, key contextKey, legacy string) string {
+	if v, ok := ctx.Value(key).(string); ok {
+		return v
+	}
+	v, _ := ctx.Value(legacy).(string)
+	return v
+}
@@ -0,0 +1,38 @@
+package apilogger
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContextAccessors(t *testing.T) {
+	ctx := context.Background()
+	ctx = WithAPIKey(ctx, "r12d3f4")
+	ctx = WithRequestID(ctx, "1234")
+	ctx = WithRemoteAddr(ctx, "127.0.0.1")
+	ctx = WithSessionID(ctx, "b011157f")
+
+	assertEquals(t, APIKeyFrom(ctx), "r12d3f4")
+	assertEquals(t, RequestIDFrom(ctx), "1234")
+	assertEquals(t, RemoteAddrFrom(ctx), "127.0.0.1")
+	assertEquals(t, SessionIDFrom(ctx), "b011157f")
+
+	// the typed keys never collide with the plain string keys
+	// other packages set, which are only a fallback
+	assertEquals(t, ctx.Value("session"), nil)
+	other := context.WithValue(ctx, "session", "other package")
+	assertEquals(t, SessionIDFrom(other), "b011157f")
+
+	logger := New(ctx, "")
+	assertEquals(t, logger.apiKey, "r12d3f4")
+	assertEquals(t, logger.requestID, "1234")
+	assertEquals(t, logger.remoteAddr, "127.0.0.1")
+	assertEquals(t, logger.session, "b011157f")
+}
+
+func TestContextAccessorsLegacyKeys(t *testing.T) {
+	ctx := context.WithValue(context.Background(), RequestIDKey, "legacy")
+	assertEquals(t, RequestIDFrom(ctx), "legacy")
+	assertEquals(t, RequestIDFrom(WithRequestID(ctx, "typed")), "typed")
+	assertEquals(t, APIKeyFrom(context.Background()), "")
+}
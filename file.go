@@ -0,0 +1,106 @@
+package apilogger
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// sharedFile is a log file opened once per path and
+// shared by all the Loggers writing to it.
+type sharedFile struct {
+	path string
+	file *os.File
+	// refs is the number of open handles, guarded by filesMu
+	refs int
+}
+
+var (
+	filesMu sync.Mutex
+	files   = make(map[string]*sharedFile)
+)
+
+// fileHandle is the reference of a Logger to a shared file.
+// Writes after Close are dropped, while the file stays open
+// for the other Loggers writing to it.
+type fileHandle struct {
+	mu     sync.RWMutex
+	shared *sharedFile
+}
+
+// openFile returns a handle to the file at path, opening it for
+// appending unless another Logger already did.
+func openFile(path string) (*fileHandle, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	shared, ok := files[path]
+	if !ok {
+		file, err := os.OpenFile(
+			path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shared = &sharedFile{path: path, file: file}
+		files[path] = shared
+	}
+	shared.refs++
+
+	return &fileHandle{shared: shared}, nil
+}
+
+// Write implements io.Writer.
+func (h *fileHandle) Write(p []byte) (int, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.shared == nil {
+		return len(p), nil
+	}
+	return h.shared.file.Write(p)
+}
+
+// Sync commits the content of the file to stable storage.
+func (h *fileHandle) Sync() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.shared == nil {
+		return nil
+	}
+	return h.shared.file.Sync()
+}
+
+// Close releases the handle, the file is synced and closed
+// once all its handles are released.
+func (h *fileHandle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.shared == nil {
+		return nil
+	}
+	shared := h.shared
+	h.shared = nil
+
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+	delete(files, shared.path)
+
+	err := shared.file.Sync()
+	if closeErr := shared.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
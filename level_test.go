@@ -0,0 +1,83 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// formatSpy records whether it has been formatted.
+type formatSpy struct {
+	formatted *bool
+}
+
+func (s formatSpy) String() string {
+	*s.formatted = true
+	return "spy"
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, lvl := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal} {
+		parsed, err := ParseLevel(strings.ToLower(lvl.String()))
+		assertEquals(t, err, nil)
+		assertEquals(t, parsed, lvl)
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestMinimumLevel(t *testing.T) {
+	var out, errOut bytes.Buffer
+	logger := New(context.Background(), "")
+	logger.output = &out
+	logger.errOutput = &errOut
+	logger.SetLevel(LevelWarn)
+
+	formatted := false
+	spy := formatSpy{&formatted}
+
+	logger.Trace(LogCatDebug, spy)
+	logger.Debugf(LogCatDebug, "%v", spy)
+	logger.InfoWF(LogCatDebug, &Fields{"spy": spy})
+	logger.Warn(LogCatDebug, "kept")
+	logger.Error(LogCatDebug, "kept")
+
+	assertEquals(t, formatted, false)
+	assertEquals(t, strings.Count(out.String(), "\n"), 1)
+	assertEquals(t, strings.HasPrefix(out.String(), prefixWarn), true)
+	assertEquals(t, strings.HasPrefix(errOut.String(), prefixError), true)
+}
+
+func TestDebugAndTraceLevels(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(context.Background(), "")
+	logger.output = &out
+
+	logger.Debug(LogCatDebug, "hidden")
+	assertEquals(t, out.String(), "")
+
+	logger.SetLevel(LevelTrace)
+	assertEquals(t, logger.Level(), LevelTrace)
+
+	logger.Trace(LogCatDebug, "trace message")
+	logger.Tracef(LogCatDebug, "trace %s", "formatted")
+	logger.TraceWF(LogCatDebug, &Fields{"step": 1})
+	logger.Debug(LogCatDebug, "debug message")
+	logger.Debugf(LogCatDebug, "debug %d", 2)
+	logger.DebugWF(LogCatDebug, &Fields{"step": 3})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assertEquals(t, len(lines), 6)
+	for i, line := range lines {
+		prefix := prefixTrace
+		if i >= 3 {
+			prefix = prefixDebug
+		}
+		assertEquals(t, strings.HasPrefix(line, prefix), true)
+	}
+	assertEquals(t, strings.Contains(lines[1], `message="trace formatted"`), true)
+	assertEquals(t, strings.Contains(lines[5], `step="3"`), true)
+}
@@ -5,30 +5,42 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// APIKEY is the context key used to
 	// access the api-key request header value
+	//
+	// Deprecated: use WithAPIKey and APIKeyFrom instead.
 	APIKEY string = "api-key"
 
 	// RequestIDKey is the context key used to
 	// access the x-request-id request header value
+	//
+	// Deprecated: use WithRequestID and RequestIDFrom instead.
 	RequestIDKey string = "x-request-id"
 
 	// RemoteAddrKey is the context key used to
 	// access the remote-address request header value
+	//
+	// Deprecated: use WithRemoteAddr and RemoteAddrFrom instead.
 	RemoteAddrKey string = "remote-address"
 
 	// SessionIDKey is the context key used to
 	// access the session request header value
+	//
+	// Deprecated: use WithSessionID and SessionIDFrom instead.
 	SessionIDKey string = "session"
 
 	// Depth of the callstack - needed to determine
 	// the initial caller function
 	depth int = 6
 
+	prefixTrace = "TRACE "
+	prefixDebug = "DEBUG "
 	prefixInfo  = "INFO "
 	prefixWarn  = "WARN "
 	prefixError = "ERROR "
@@ -37,11 +49,21 @@ const (
 
 // Logger struct
 type Logger struct {
+	// once guards the creation of the level loggers
+	once       sync.Once
+	traceLog   *log.Logger
+	debugLog   *log.Logger
 	infoLog    *log.Logger
 	warningLog *log.Logger
 	errorLog   *log.Logger
+	fatalLog   *log.Logger
 	output     io.Writer
 	errOutput  io.Writer
+	// level is the minimum Level of the
+	// entries written, accessed atomically
+	level int32
+	// file is the log file of the Logger, if any
+	file       *fileHandle
 	startTime  time.Time
 	requestID  string
 	apiKey     string
@@ -51,14 +73,21 @@ type Logger struct {
 
 type Fields map[string]interface{}
 
+// exit terminates the program after a Fatal entry,
+// replaced in tests.
+var exit = os.Exit
+
 // New returns a new Logger instance.
 func New(ctx context.Context, outPath string) *Logger {
 	var output io.Writer = os.Stdout
 	var errOutput io.Writer = os.Stderr
+	var file *fileHandle
 
 	if len(outPath) != 0 {
-		file, err := os.OpenFile(
-			outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		var err error
+		// the file is shared with the other Loggers of the path,
+		// so a Logger per request does not cost a descriptor
+		file, err = openFile(outPath)
 
 		if err != nil {
 			log.Println("Failed to open log file", err)
@@ -71,10 +100,10 @@ func New(ctx context.Context, outPath string) *Logger {
 
 	var id, apiKey, addr, session string
 	if ctx != nil {
-		id, _ = ctx.Value(RequestIDKey).(string)
-		apiKey, _ = ctx.Value(APIKEY).(string)
-		addr, _ = ctx.Value(RemoteAddrKey).(string)
-		session, _ = ctx.Value(SessionIDKey).(string)
+		id = RequestIDFrom(ctx)
+		apiKey = APIKeyFrom(ctx)
+		addr = RemoteAddrFrom(ctx)
+		session = SessionIDFrom(ctx)
 	}
 
 	return &Logger{
@@ -85,7 +114,68 @@ func New(ctx context.Context, outPath string) *Logger {
 		session:    session,
 		output:     output,
 		errOutput:  errOutput,
+		file:       file,
+	}
+}
+
+// Sync commits the lines written to the log file
+// of the Logger to stable storage.
+func (l *Logger) Sync() error {
+	if l.file == nil {
+		return nil
 	}
+	return l.file.Sync()
+}
+
+// Close releases the log file of the Logger, which is synced and
+// closed once no other Logger writes to it. Lines logged afterwards
+// are only written to the standard outputs.
+func (l *Logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// fatal writes the message, syncs the log file and exits.
+func (l *Logger) fatal(message string) {
+	l.fatalLog.Println(message)
+	if err := l.Sync(); err != nil {
+		log.Println("Failed to sync log file", err)
+	}
+	exit(1)
+}
+
+// init creates the level loggers on first use. The fatal
+// logger is kept apart so Fatal never changes the prefix of
+// the lines written by concurrent Error calls.
+func (l *Logger) init() {
+	l.once.Do(func() {
+		l.traceLog = log.New(l.output, prefixTrace, log.Ldate|log.Ltime)
+		l.debugLog = log.New(l.output, prefixDebug, log.Ldate|log.Ltime)
+		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+		l.fatalLog = log.New(l.errOutput, prefixFatal, log.Ldate|log.Ltime)
+	})
+}
+
+// SetLevel sets the minimum level of the entries written,
+// LevelInfo until it is set. It is safe for concurrent use.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Level returns the minimum level of the entries written.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+// enabled reports whether entries of the level are written. It is
+// checked before the caller is resolved and the message formatted,
+// so disabled entries cost next to nothing.
+func (l *Logger) enabled(level Level) bool {
+	return level >= l.Level()
 }
 
 // prints message.
@@ -103,109 +193,169 @@ func (l *Logger) printlnf(logger *log.Logger, logCat LogCat, format string, v ..
 	logger.Println(finalMessagef(l, logCat, format, v...))
 }
 
+// Trace prints message at trace level.
+func (l *Logger) Trace(logCat LogCat, v ...interface{}) {
+	if !l.enabled(LevelTrace) {
+		return
+	}
+	l.init()
+
+	l.println(l.traceLog, logCat, v...)
+}
+
+// Tracef prints message at trace level using the specified format.
+func (l *Logger) Tracef(logCat LogCat, format string, v ...interface{}) {
+	if !l.enabled(LevelTrace) {
+		return
+	}
+	l.init()
+
+	l.printlnf(l.traceLog, logCat, format, v...)
+}
+
+// TraceWF prints message at trace level using Fields with multiple key=value pairs.
+func (l *Logger) TraceWF(logCat LogCat, fields *Fields) {
+	if !l.enabled(LevelTrace) {
+		return
+	}
+	l.init()
+
+	l.printlnWF(l.traceLog, logCat, fields)
+}
+
+// Debug prints message at debug level.
+func (l *Logger) Debug(logCat LogCat, v ...interface{}) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.init()
+
+	l.println(l.debugLog, logCat, v...)
+}
+
+// Debugf prints message at debug level using the specified format.
+func (l *Logger) Debugf(logCat LogCat, format string, v ...interface{}) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.init()
+
+	l.printlnf(l.debugLog, logCat, format, v...)
+}
+
+// DebugWF prints message at debug level using Fields with multiple key=value pairs.
+func (l *Logger) DebugWF(logCat LogCat, fields *Fields) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.init()
+
+	l.printlnWF(l.debugLog, logCat, fields)
+}
+
 func (l *Logger) Info(logCat LogCat, v ...interface{}) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+	if !l.enabled(LevelInfo) {
+		return
 	}
+	l.init()
 
 	l.println(l.infoLog, logCat, v...)
 }
 
 // Infof prints a message using the specified format.
 func (l *Logger) Infof(logCat LogCat, format string, v ...interface{}) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+	if !l.enabled(LevelInfo) {
+		return
 	}
+	l.init()
 
 	l.printlnf(l.infoLog, logCat, format, v...)
 }
 
 // InfoWF prints message using Fields struct to pass multiple key=value pairs.
 func (l *Logger) InfoWF(logCat LogCat, fields *Fields) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+	if !l.enabled(LevelInfo) {
+		return
 	}
+	l.init()
 
 	l.printlnWF(l.infoLog, logCat, fields)
 }
 
 func (l *Logger) Warn(logCat LogCat, v ...interface{}) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if !l.enabled(LevelWarn) {
+		return
 	}
+	l.init()
 
 	l.println(l.warningLog, logCat, v...)
 }
 
 func (l *Logger) Warnf(logCat LogCat, format string, v ...interface{}) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if !l.enabled(LevelWarn) {
+		return
 	}
+	l.init()
 
 	l.printlnf(l.warningLog, logCat, format, v...)
 }
 
 // WarnWF prints message with fields to use multiple key=value pairs.
 func (l *Logger) WarnWF(logCat LogCat, fields *Fields) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if !l.enabled(LevelWarn) {
+		return
 	}
+	l.init()
 	l.printlnWF(l.warningLog, logCat, fields)
 }
 
 // Error prints message at error level.
 func (l *Logger) Error(logCat LogCat, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+	if !l.enabled(LevelError) {
+		return
 	}
+	l.init()
 
 	l.println(l.errorLog, logCat, v...)
 }
 
 // Errorf prints message at error level.
 func (l *Logger) Errorf(logCat LogCat, format string, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+	if !l.enabled(LevelError) {
+		return
 	}
+	l.init()
 
 	l.printlnf(l.errorLog, logCat, format, v...)
 }
 
 // ErrorWF prints message at error level using Fields with multiple key=value pairs.
 func (l *Logger) ErrorWF(logCat LogCat, fields *Fields) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+	if !l.enabled(LevelError) {
+		return
 	}
+	l.init()
 
 	l.printlnWF(l.errorLog, logCat, fields)
 }
 
 // Fatal prints and calls os.exit(1).
 func (l *Logger) Fatal(logCat LogCat, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.init()
 
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessage(l, logCat, v...))
+	l.fatal(finalMessage(l, logCat, v...))
 }
 
 // Fatalf prints and calls os.exit(1).
 func (l *Logger) Fatalf(logCat LogCat, format string, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.init()
 
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessagef(l, logCat, format, v...))
+	l.fatal(finalMessagef(l, logCat, format, v...))
 }
 
 // FatalWF prints and calls os.exit(1) with multiple key=value pairs.
 func (l *Logger) FatalWF(logCat LogCat, fields *Fields) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.init()
 
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessageWF(l, logCat, fields))
+	l.fatal(finalMessageWF(l, logCat, fields))
 }
@@ -2,8 +2,12 @@ package apilogger
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -140,3 +144,110 @@ func assertStrContains(t *testing.T, output string, expected string) {
 		t.Errorf("Output insufficient - [%s]", output)
 	}
 }
+
+func TestConcurrentLogging(t *testing.T) {
+	const goroutines, iterations = 8, 100
+
+	rq, err := http.NewRequest("GET", "/test", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	logger := New(rq.Context(), "")
+	logger.output = ioutil.Discard
+	logger.errOutput = ioutil.Discard
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				logger.Info(LogCatDebug, "info")
+				logger.Warnf(LogCatDebug, "warn %d", i)
+				logger.ErrorWF(LogCatDebug, &Fields{"step": i})
+			}
+		}()
+	}
+	wg.Wait()
+
+	assertEquals(t, logger.errorLog.Prefix(), prefixError)
+	assertEquals(t, logger.fatalLog.Prefix(), prefixFatal)
+}
+
+func TestSharedLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apilogger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.log")
+
+	first := New(context.Background(), path)
+	second := New(context.Background(), path)
+	first.output, first.errOutput = first.file, first.file
+	second.output, second.errOutput = second.file, second.file
+
+	assertEquals(t, first.file.shared, second.file.shared)
+	assertEquals(t, first.file.shared.refs, 2)
+
+	first.Info(LogCatDebug, "first")
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	first.Info(LogCatDebug, "dropped")
+
+	// the file stays open for the second logger
+	second.Warn(LogCatDebug, "second")
+	if err := second.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	filesMu.Lock()
+	_, open := files[path]
+	filesMu.Unlock()
+	assertEquals(t, open, false)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assertEquals(t, len(lines), 2)
+	assertEquals(t, strings.HasPrefix(lines[0], "INFO "), true)
+	assertEquals(t, strings.HasPrefix(lines[1], "WARN "), true)
+
+	// a new logger opens the file again
+	third := New(context.Background(), path)
+	defer third.Close()
+	assertEquals(t, third.file.shared.refs, 1)
+}
+
+func TestFatalSyncsLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apilogger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.log")
+
+	exits := 0
+	exit = func(int) { exits++ }
+	defer func() { exit = os.Exit }()
+
+	logger := New(context.Background(), path)
+	defer logger.Close()
+	logger.errOutput = logger.file
+
+	logger.Fatalf(LogCatDebug, "fatal %d", 1)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, exits, 1)
+	assertEquals(t, strings.HasPrefix(string(data), "FATAL "), true)
+}
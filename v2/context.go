@@ -0,0 +1,115 @@
+package apilogger
+
+import (
+	"context"
+	"time"
+)
+
+// contextKey is the type of the context keys of the package,
+// so its values never collide with those set by other packages
+// with the same names.
+type contextKey int
+
+const (
+	apiKeyKey contextKey = iota
+	requestIDKey
+	remoteAddrKey
+	sessionIDKey
+	startTimeKey
+	traceKey
+)
+
+// WithAPIKey returns a copy of ctx carrying the api-key of the request.
+func WithAPIKey(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, apiKeyKey, apiKey)
+}
+
+// APIKeyFrom returns the api-key set on ctx by WithAPIKey,
+// or with the deprecated APIKEY key.
+func APIKeyFrom(ctx context.Context) string {
+	return stringValue(ctx, apiKeyKey, APIKEY)
+}
+
+// WithRequestID returns a copy of ctx carrying the id of the request.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFrom returns the request id set on ctx by
+// WithRequestID, or with the deprecated RequestIDKey key.
+func RequestIDFrom(ctx context.Context) string {
+	return stringValue(ctx, requestIDKey, RequestIDKey)
+}
+
+// WithRemoteAddr returns a copy of ctx carrying the address of the client.
+func WithRemoteAddr(ctx context.Context, remoteAddr string) context.Context {
+	return context.WithValue(ctx, remoteAddrKey, remoteAddr)
+}
+
+// RemoteAddrFrom returns the client address set on ctx by
+// WithRemoteAddr, or with the deprecated RemoteAddrKey key.
+func RemoteAddrFrom(ctx context.Context) string {
+	return stringValue(ctx, remoteAddrKey, RemoteAddrKey)
+}
+
+// WithSessionID returns a copy of ctx carrying the session id of the request.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionIDFrom returns the session id set on ctx by
+// WithSessionID, or with the deprecated SessionIDKey key.
+func SessionIDFrom(ctx context.Context) string {
+	return stringValue(ctx, sessionIDKey, SessionIDKey)
+}
+
+// WithStartTime returns a copy of ctx carrying
+// the start time of the transaction.
+func WithStartTime(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, startTimeKey, start)
+}
+
+// StartTimeFrom returns the start time set on ctx by
+// WithStartTime, or with the deprecated StartTime key.
+func StartTimeFrom(ctx context.Context) time.Time {
+	if v, ok := ctx.Value(startTimeKey).(time.Time); ok {
+		return v
+	}
+	v, _ := ctx.Value(StartTime).(time.Time)
+	return v
+}
+
+// WithTraceparent returns a copy of ctx carrying the trace context
+// of a W3C traceparent header value, which the lines logged with the
+// context are correlated to by their trace_id, span_id and
+// trace_flags keys, or ctx and an error when the value is invalid.
+func WithTraceparent(ctx context.Context, traceparent string) (context.Context, error) {
+	tc, err := parseTraceparent(traceparent)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, traceKey, tc), nil
+}
+
+// TraceparentFrom returns the trace context set on ctx by
+// WithTraceparent as a version 00 traceparent value, or an
+// empty string when there is none.
+func TraceparentFrom(ctx context.Context) string {
+	return traceFrom(ctx).traceparent()
+}
+
+// traceFrom returns the trace context set on ctx by WithTraceparent.
+func traceFrom(ctx context.Context) traceContext {
+	tc, _ := ctx.Value(traceKey).(traceContext)
+	return tc
+}
+
+// stringValue returns the value of key in ctx, falling back to
+// the value of its legacy string key while callers migrate.
+func stringValue(ctx context.Context, key contextKey, legacy string) string {
+	if v, ok := ctx.Value(key).(string); ok {
+		return v
+	}
+	v, _ := ctx.Value(legacy).(string)
+	return v
+}
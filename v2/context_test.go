@@ -0,0 +1,52 @@
+package apilogger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+func TestContextAccessors(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	ctx := context.Background()
+	ctx = WithAPIKey(ctx, "apikey1")
+	ctx = WithRequestID(ctx, "requestId1")
+	ctx = WithRemoteAddr(ctx, "10.0.0.7")
+	ctx = WithSessionID(ctx, "session1")
+	ctx = WithStartTime(ctx, start)
+
+	assert := assertion.New(t)
+	assert.Equal("apikey1", APIKeyFrom(ctx))
+	assert.Equal("requestId1", RequestIDFrom(ctx))
+	assert.Equal("10.0.0.7", RemoteAddrFrom(ctx))
+	assert.Equal("session1", SessionIDFrom(ctx))
+	assert.Equal(start, StartTimeFrom(ctx))
+
+	// the typed keys never collide with the plain string keys
+	// other packages set, which are only a fallback
+	assert.Nil(ctx.Value("session"))
+	other := context.WithValue(ctx, "session", "other package")
+	assert.Equal("session1", SessionIDFrom(other))
+
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+	logger.Info(ctx, LogCatDebug, "typed keys")
+	assert.Contains(out.String(), `requestId="requestId1", clientIp="10.0.0.7", apiKey="apikey1", sessionId="session1"`)
+	assert.NotContains(out.String(), `ms="0.000000"`)
+}
+
+func TestContextAccessorsLegacyKeys(t *testing.T) {
+	start := time.Now()
+	ctx := context.WithValue(context.Background(), RequestIDKey, "legacy")
+	ctx = context.WithValue(ctx, StartTime, start)
+
+	assert := assertion.New(t)
+	assert.Equal("legacy", RequestIDFrom(ctx))
+	assert.Equal(start, StartTimeFrom(ctx))
+	assert.Equal("typed", RequestIDFrom(WithRequestID(ctx, "typed")))
+	assert.Empty(APIKeyFrom(context.Background()))
+	assert.True(StartTimeFrom(context.Background()).IsZero())
+}
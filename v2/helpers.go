@@ -7,6 +7,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // location returns the location of the log call
@@ -46,8 +48,23 @@ func formatIPAddr(addr string) string {
 	return fmt.Sprintf("%s", r.FindString(addr))
 }
 
-// builds standard information.
-func baseMessage(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string) string {
+// lineKey replaces the characters of a key that could forge fields
+// or lines, spaces, '=', '"', ',' and control characters, with '_'.
+func lineKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == ',' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// builds standard information. Values are quoted and escaped,
+// so client supplied values can neither forge fields nor lines.
+func baseMessage(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext) string {
 	var elapsed time.Duration
 	// If time is nonzero
 	if !startTime.IsZero() {
@@ -55,8 +72,8 @@ func baseMessage(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAd
 	}
 	msElapsed := float64(elapsed.Nanoseconds()) / float64(time.Millisecond)
 
-	return fmt.Sprintf(
-		`location="%s", requestId="%s", clientIp="%s", apiKey="%s", sessionId="%s", ms="%f", function="%s", code="%s", type="%s"`,
+	base := fmt.Sprintf(
+		`location=%q, requestId=%q, clientIp=%q, apiKey=%q, sessionId=%q, ms="%f", function=%q, code=%q, type=%q`,
 		location(),
 		requestID,
 		remoteAddr,
@@ -67,15 +84,19 @@ func baseMessage(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAd
 		logCat.Code,
 		logCat.Type,
 	)
+	if trace.traceID == "" {
+		return base
+	}
+	return base + fmt.Sprintf(`, trace_id="%s", span_id="%s", trace_flags="%s"`, trace.traceID, trace.spanID, trace.flags)
 }
 
 // formats and finalizes the log content
-func finalMessageWF(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, fields *Fields) string {
-	base := baseMessage(logCat, startTime, requestID, apiKey, remoteAddr, session)
+func finalMessageWF(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext, fields *Fields) string {
+	base := baseMessage(logCat, startTime, requestID, apiKey, remoteAddr, session, trace)
 	msg := ""
 
 	for k, v := range *fields {
-		msg += fmt.Sprintf(`%s="%v", `, k, v)
+		msg += fmt.Sprintf(`%s=%q, `, lineKey(k), fmt.Sprint(v))
 	}
 
 	msg = strings.TrimRight(msg, ", ")
@@ -84,19 +105,19 @@ func finalMessageWF(logCat LogCat, startTime time.Time, requestID, apiKey, remot
 }
 
 // formats and finalizes the log content
-func finalMessage(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, v ...interface{}) string {
-	base := baseMessage(logCat, startTime, requestID, apiKey, remoteAddr, session)
+func finalMessage(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext, v ...interface{}) string {
+	base := baseMessage(logCat, startTime, requestID, apiKey, remoteAddr, session, trace)
 	msg := fmt.Sprint(v...)
-	wrappedMsg := fmt.Sprintf(`message="%s"`, msg)
+	wrappedMsg := fmt.Sprintf(`message=%q`, msg)
 
 	return base + ", " + wrappedMsg
 }
 
 // formats and finalizes the log content
-func finalMessagef(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session, format string, v ...interface{}) string {
-	base := baseMessage(logCat, startTime, requestID, apiKey, remoteAddr, session)
+func finalMessagef(logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext, format string, v ...interface{}) string {
+	base := baseMessage(logCat, startTime, requestID, apiKey, remoteAddr, session, trace)
 	msg := fmt.Sprintf(format, v...)
-	wrappedMsg := fmt.Sprintf(`message="%s"`, msg)
+	wrappedMsg := fmt.Sprintf(`message=%q`, msg)
 
 	return base + ", " + wrappedMsg
 }
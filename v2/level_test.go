@@ -0,0 +1,96 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// formatSpy records whether it has been formatted.
+type formatSpy struct {
+	formatted *bool
+}
+
+func (s formatSpy) String() string {
+	*s.formatted = true
+	return "spy"
+}
+
+func TestParseLevel(t *testing.T) {
+	assert := assertion.New(t)
+
+	for _, lvl := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal} {
+		parsed, err := ParseLevel(strings.ToLower(lvl.String()))
+		assert.NoError(err)
+		assert.Equal(lvl, parsed)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.Error(err)
+}
+
+func TestMinimumLevel(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	logger := New()
+	logger.output = &out
+	logger.errOutput = &errOut
+	logger.SetLevel(LevelWarn)
+
+	ctx := context.Background()
+	formatted := false
+	spy := formatSpy{&formatted}
+
+	logger.Trace(ctx, LogCatDebug, spy)
+	logger.Debugf(ctx, LogCatDebug, "%v", spy)
+	logger.InfoWF(ctx, LogCatDebug, &Fields{"spy": spy})
+	Debug(ctx, LogCatDebug, spy)
+	logger.Warn(ctx, LogCatDebug, "kept")
+	logger.Error(ctx, LogCatDebug, "kept")
+
+	assert := assertion.New(t)
+	assert.False(formatted)
+	assert.Equal(1, strings.Count(out.String(), "\n"))
+	assert.True(strings.HasPrefix(out.String(), prefixWarn))
+	assert.True(strings.HasPrefix(errOut.String(), prefixError))
+}
+
+func TestDebugAndTraceLevels(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := New()
+	logger.output = &out
+
+	ctx := WithRequestID(context.Background(), "1234")
+	logger.Debug(ctx, LogCatDebug, "hidden")
+	assertion.Empty(t, out.String())
+
+	logger.SetLevel(LevelTrace)
+	assertion.Equal(t, LevelTrace, logger.Level())
+
+	logger.Trace(ctx, LogCatDebug, "trace message")
+	logger.Tracef(ctx, LogCatDebug, "trace %s", "formatted")
+	logger.TraceWF(ctx, LogCatDebug, &Fields{"step": 1})
+	Debug(ctx, LogCatDebug, "debug message")
+	Debugf(ctx, LogCatDebug, "debug %d", 2)
+	DebugWF(ctx, LogCatDebug, &Fields{"step": 3})
+
+	assert := assertion.New(t)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !assert.Len(lines, 6) {
+		return
+	}
+	for i, line := range lines {
+		prefix := prefixTrace
+		if i >= 3 {
+			prefix = prefixDebug
+		}
+		assert.True(strings.HasPrefix(line, prefix), line)
+		assert.Contains(line, `requestId="1234"`)
+	}
+	assert.Contains(lines[1], `message="trace formatted"`)
+	assert.Contains(lines[5], `step="3"`)
+}
@@ -5,34 +5,48 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// APIKEY is the context key used to
 	// access the api-key request header value
+	//
+	// Deprecated: use WithAPIKey and APIKeyFrom instead.
 	APIKEY string = "api-key"
 
 	// RequestIDKey is the context key used to
 	// access the x-request-id request header value
+	//
+	// Deprecated: use WithRequestID and RequestIDFrom instead.
 	RequestIDKey string = "x-request-id"
 
 	// RemoteAddrKey is the context key used to
 	// access the remote-address request header value
+	//
+	// Deprecated: use WithRemoteAddr and RemoteAddrFrom instead.
 	RemoteAddrKey string = "remote-address"
 
 	// SessionIDKey is the context key used to
 	// access the session request header value
+	//
+	// Deprecated: use WithSessionID and SessionIDFrom instead.
 	SessionIDKey string = "session"
 
 	// StartTime is the context key used to
 	// access start time of transaction
+	//
+	// Deprecated: use WithStartTime and StartTimeFrom instead.
 	StartTime string = "start-time"
 
 	// Depth of the callstack - needed to determine
 	// the initial caller function
 	depth int = 6
 
+	prefixTrace = "TRACE "
+	prefixDebug = "DEBUG "
 	prefixInfo  = "INFO "
 	prefixWarn  = "WARN "
 	prefixError = "ERROR "
@@ -41,11 +55,28 @@ const (
 
 // Logger struct
 type Logger struct {
+	// once guards the creation of the level loggers
+	once       sync.Once
+	traceLog   *log.Logger
+	debugLog   *log.Logger
 	infoLog    *log.Logger
 	warningLog *log.Logger
 	errorLog   *log.Logger
-	output     io.Writer
-	errOutput  io.Writer
+	fatalLog   *log.Logger
+
+	// mu guards the outputs against concurrent SetOutputFile calls
+	mu        sync.Mutex
+	output    io.Writer
+	errOutput io.Writer
+	// level is the minimum Level of the
+	// entries written, accessed atomically
+	level int32
+
+	// files are the log files opened by SetOutputFile, and
+	// stdOutput and stdErrOutput the outputs restored by Close
+	files        []*logFile
+	stdOutput    io.Writer
+	stdErrOutput io.Writer
 
 	// requestID  string
 	// apiKey     string
@@ -57,6 +88,10 @@ type Fields map[string]interface{}
 
 var defaultLogger *Logger
 
+// exit terminates the program after a Fatal entry,
+// replaced in tests.
+var exit = os.Exit
+
 // New returns a new Logger instance.
 func New() *Logger {
 	defaultLogger = &Logger{
@@ -68,75 +103,296 @@ func New() *Logger {
 
 // Set logger to file
 func (l *Logger) SetOutputFile(outPath string) error {
-	file, err := os.OpenFile(
-		outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-
+	file, err := openLogFile(outPath)
 	if err != nil {
 		log.Println("Failed to open log file", err)
 		return err
 	}
 
-	l.output = io.MultiWriter(file, l.output)
-	l.errOutput = io.MultiWriter(file, l.errOutput)
+	l.init()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.files) == 0 {
+		l.stdOutput, l.stdErrOutput = l.output, l.errOutput
+	}
+	l.files = append(l.files, file)
+
+	l.setOutputs(io.MultiWriter(file, l.output), io.MultiWriter(file, l.errOutput))
 	return nil
 }
 
-// prints message.
-func (l *Logger) printlnWF(logger *log.Logger, logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, fields *Fields) {
-	logger.Println(finalMessageWF(logCat, startTime, requestID, apiKey, remoteAddr, session, fields))
+// setOutputs changes the outputs of the level loggers.
+// It must be called with mu held.
+func (l *Logger) setOutputs(output, errOutput io.Writer) {
+	l.output = output
+	l.errOutput = errOutput
+
+	l.traceLog.SetOutput(l.output)
+	l.debugLog.SetOutput(l.output)
+	l.infoLog.SetOutput(l.output)
+	l.warningLog.SetOutput(l.output)
+	l.errorLog.SetOutput(l.errOutput)
+	l.fatalLog.SetOutput(l.errOutput)
 }
 
-func (l *Logger) println(logger *log.Logger, logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, v ...interface{}) {
-	logger.Println(finalMessage(logCat, startTime, requestID, apiKey, remoteAddr, session, v...))
+// Sync commits the lines written to the log
+// files of the Logger to stable storage.
+func (l *Logger) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	for _, file := range l.files {
+		if syncErr := file.Sync(); err == nil {
+			err = syncErr
+		}
+	}
+	return err
 }
 
-func (l *Logger) printlnf(logger *log.Logger, logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, format string, v ...interface{}) {
-	logger.Println(finalMessagef(logCat, startTime, requestID, apiKey, remoteAddr, session, format, v...))
+// Close syncs and closes the log files opened by SetOutputFile.
+// Lines logged afterwards are only written to the standard outputs.
+func (l *Logger) Close() error {
+	l.init()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.files) == 0 {
+		return nil
+	}
+
+	// no line is written to the files once the level
+	// loggers switched back to the standard outputs
+	l.setOutputs(l.stdOutput, l.stdErrOutput)
+
+	var err error
+	for _, file := range l.files {
+		if syncErr := file.Sync(); err == nil {
+			err = syncErr
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	l.files = nil
+	l.stdOutput, l.stdErrOutput = nil, nil
+	return err
 }
 
-func (l *Logger) Info(ctx context.Context, logCat LogCat, v ...interface{}) {
-	if l.infoLog == nil {
+// fatal writes the message, syncs the log files and exits.
+func (l *Logger) fatal(message string) {
+	l.fatalLog.Println(message)
+	if err := l.Sync(); err != nil {
+		log.Println("Failed to sync log file", err)
+	}
+	exit(1)
+}
+
+// init creates the level loggers on first use. The fatal
+// logger is kept apart so Fatal never changes the prefix of
+// the lines written by concurrent Error calls.
+func (l *Logger) init() {
+	l.once.Do(func() {
+		l.traceLog = log.New(l.output, prefixTrace, log.Ldate|log.Ltime)
+		l.debugLog = log.New(l.output, prefixDebug, log.Ldate|log.Ltime)
 		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+		l.fatalLog = log.New(l.errOutput, prefixFatal, log.Ldate|log.Ltime)
+	})
+}
+
+// SetLevel sets the minimum level of the entries written,
+// LevelInfo until it is set. It is safe for concurrent use.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Level returns the minimum level of the entries written.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+// enabled reports whether entries of the level are written. It is
+// checked before the caller is resolved and the message formatted,
+// so disabled entries cost next to nothing.
+func (l *Logger) enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// prints message.
+func (l *Logger) printlnWF(logger *log.Logger, logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext, fields *Fields) {
+	logger.Println(finalMessageWF(logCat, startTime, requestID, apiKey, remoteAddr, session, trace, fields))
+}
+
+func (l *Logger) println(logger *log.Logger, logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext, v ...interface{}) {
+	logger.Println(finalMessage(logCat, startTime, requestID, apiKey, remoteAddr, session, trace, v...))
+}
+
+func (l *Logger) printlnf(logger *log.Logger, logCat LogCat, startTime time.Time, requestID, apiKey, remoteAddr, session string, trace traceContext, format string, v ...interface{}) {
+	logger.Println(finalMessagef(logCat, startTime, requestID, apiKey, remoteAddr, session, trace, format, v...))
+}
+
+// Trace prints message at trace level.
+func (l *Logger) Trace(ctx context.Context, logCat LogCat, v ...interface{}) {
+	if !l.enabled(LevelTrace) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.println(l.traceLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, v...)
+}
+
+// Tracef prints message at trace level using the specified format.
+func (l *Logger) Tracef(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
+	if !l.enabled(LevelTrace) {
+		return
+	}
+	l.init()
 
-	l.println(l.infoLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, v...)
+	// Extract contextual values
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnf(l.traceLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, format, v...)
 }
 
-func (l *Logger) Infof(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+// TraceWF prints message at trace level using Fields with multiple key=value pairs.
+func (l *Logger) TraceWF(ctx context.Context, logCat LogCat, fields *Fields) {
+	if !l.enabled(LevelTrace) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnWF(l.traceLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, fields)
+}
+
+// Debug prints message at debug level.
+func (l *Logger) Debug(ctx context.Context, logCat LogCat, v ...interface{}) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.init()
 
-	l.printlnf(l.infoLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, format, v...)
+	// Extract contextual values
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.println(l.debugLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, v...)
 }
 
-func (l *Logger) InfoWF(ctx context.Context, logCat LogCat, fields *Fields) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+// Debugf prints message at debug level using the specified format.
+func (l *Logger) Debugf(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
+	if !l.enabled(LevelDebug) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnf(l.debugLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, format, v...)
+}
+
+// DebugWF prints message at debug level using Fields with multiple key=value pairs.
+func (l *Logger) DebugWF(ctx context.Context, logCat LogCat, fields *Fields) {
+	if !l.enabled(LevelDebug) {
+		return
+	}
+	l.init()
 
-	l.printlnWF(l.infoLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, fields)
+	// Extract contextual values
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnWF(l.debugLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, fields)
+}
+
+func (l *Logger) Info(ctx context.Context, logCat LogCat, v ...interface{}) {
+	if !l.enabled(LevelInfo) {
+		return
+	}
+	l.init()
+
+	// Extract contextual values
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.println(l.infoLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, v...)
+}
+
+func (l *Logger) Infof(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
+	if !l.enabled(LevelInfo) {
+		return
+	}
+	l.init()
+
+	// Extract contextual values
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnf(l.infoLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, format, v...)
+}
+
+func (l *Logger) InfoWF(ctx context.Context, logCat LogCat, fields *Fields) {
+	if !l.enabled(LevelInfo) {
+		return
+	}
+	l.init()
+
+	// Extract contextual values
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnWF(l.infoLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, fields)
 }
 
 func (l *Logger) Printf(s string, i ...interface{}) {
@@ -144,141 +400,177 @@ func (l *Logger) Printf(s string, i ...interface{}) {
 }
 
 func (l *Logger) Warn(ctx context.Context, logCat LogCat, v ...interface{}) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if !l.enabled(LevelWarn) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.println(l.warningLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, v...)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.println(l.warningLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, v...)
 }
 
 func (l *Logger) Warnf(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if !l.enabled(LevelWarn) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.printlnf(l.warningLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, format, v...)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnf(l.warningLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, format, v...)
 }
 
 func (l *Logger) WarnWF(ctx context.Context, logCat LogCat, fields *Fields) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if !l.enabled(LevelWarn) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.printlnWF(l.warningLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, fields)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnWF(l.warningLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, fields)
 }
 
 func (l *Logger) Error(ctx context.Context, logCat LogCat, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+	if !l.enabled(LevelError) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.println(l.errorLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, v...)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.println(l.errorLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, v...)
 }
 
 func (l *Logger) Errorf(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+	if !l.enabled(LevelError) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.printlnf(l.errorLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, format, v...)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnf(l.errorLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, format, v...)
 }
 
 func (l *Logger) ErrorWF(ctx context.Context, logCat LogCat, fields *Fields) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+	if !l.enabled(LevelError) {
+		return
 	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.printlnWF(l.errorLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, fields)
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.printlnWF(l.errorLog, logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, fields)
 }
 
 func (l *Logger) Fatal(ctx context.Context, logCat LogCat, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessage(logCat, startTime, requestID, apiKey, remoteAddr, sessionID, v...))
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.fatal(finalMessage(logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, v...))
 }
 
 func (l *Logger) Fatalf(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessagef(logCat, startTime, requestID, apiKey, remoteAddr, sessionID, format, v...))
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.fatal(finalMessagef(logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, format, v...))
 }
 
 func (l *Logger) FatalWF(ctx context.Context, logCat LogCat, fields *Fields) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.init()
 
 	// Extract contextual values
-	requestID, _ := ctx.Value(RequestIDKey).(string)
-	apiKey, _ := ctx.Value(APIKEY).(string)
-	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
-	sessionID, _ := ctx.Value(SessionIDKey).(string)
-	startTime, _ := ctx.Value(StartTime).(time.Time)
-
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessageWF(logCat, startTime, requestID, apiKey, remoteAddr, sessionID, fields))
+	requestID := RequestIDFrom(ctx)
+	apiKey := APIKeyFrom(ctx)
+	remoteAddr := RemoteAddrFrom(ctx)
+	sessionID := SessionIDFrom(ctx)
+	startTime := StartTimeFrom(ctx)
+	trace := traceFrom(ctx)
+
+	l.fatal(finalMessageWF(logCat, startTime, requestID, apiKey, remoteAddr, sessionID, trace, fields))
+}
+
+// Trace prints message at trace level.
+func Trace(ctx context.Context, logCat LogCat, v ...interface{}) {
+	defaultLogger.Trace(ctx, logCat, v...)
+}
+
+// Tracef prints message at trace level using the specified format.
+func Tracef(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
+	defaultLogger.Tracef(ctx, logCat, format, v...)
+}
+
+// TraceWF prints message at trace level using Fields with multiple key=value pairs.
+func TraceWF(ctx context.Context, logCat LogCat, fields *Fields) {
+	defaultLogger.TraceWF(ctx, logCat, fields)
+}
+
+// Debug prints message at debug level.
+func Debug(ctx context.Context, logCat LogCat, v ...interface{}) {
+	defaultLogger.Debug(ctx, logCat, v...)
+}
+
+// Debugf prints message at debug level using the specified format.
+func Debugf(ctx context.Context, logCat LogCat, format string, v ...interface{}) {
+	defaultLogger.Debugf(ctx, logCat, format, v...)
+}
+
+// DebugWF prints message at debug level using Fields with multiple key=value pairs.
+func DebugWF(ctx context.Context, logCat LogCat, fields *Fields) {
+	defaultLogger.DebugWF(ctx, logCat, fields)
 }
 
 // Info prints message with logging level of info
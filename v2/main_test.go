@@ -1,8 +1,15 @@
 package apilogger
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -46,7 +53,7 @@ func TestFormatIPAddr(t *testing.T) {
 func TestBaseMessage(t *testing.T) {
 	// mimics call stack depth
 	func1 := func() string {
-		return baseMessage(LogCatDebug, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1")
+		return baseMessage(LogCatDebug, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", traceContext{})
 	}
 	func2 := func() string { return func1() }
 	func3 := func() string { return func2() }
@@ -62,7 +69,7 @@ func TestBaseMessage(t *testing.T) {
 
 func TestFinalMessage(t *testing.T) {
 	logCat := LogCatStartUp
-	output := finalMessage(logCat, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", "hello test")
+	output := finalMessage(logCat, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", traceContext{}, "hello test")
 	assert := assertion.New(t)
 
 	assert.Contains(output, "hello test")
@@ -72,7 +79,7 @@ func TestFinalMessage(t *testing.T) {
 
 func TestFinalMessagef(t *testing.T) {
 	logCat := LogCatStartUp
-	output := finalMessagef(logCat, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", "%s", "hello test")
+	output := finalMessagef(logCat, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", traceContext{}, "%s", "hello test")
 	assert := assertion.New(t)
 
 	assert.Contains(output, " message=\"hello test\"")
@@ -82,10 +89,157 @@ func TestFinalMessagef(t *testing.T) {
 
 func TestFinalMessageWF(t *testing.T) {
 	logCat := LogCatStartUp
-	output := finalMessageWF(logCat, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", &Fields{"message": "hello test"})
+	output := finalMessageWF(logCat, time.Now(), "requestID1", "apiKey1", "remoteAddr1", "sessionID1", traceContext{}, &Fields{"message": "hello test"})
 	assert := assertion.New(t)
 
 	assert.Contains(output, " message=\"hello test\"")
 	assert.Contains(output, " code=\""+logCat.Code+"\"")
 	assert.Contains(output, " type=\""+logCat.Type+"\"")
 }
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConcurrentLogging(t *testing.T) {
+	const goroutines, iterations = 8, 100
+
+	out, errOut := &syncBuffer{}, &syncBuffer{}
+	logger := New()
+	logger.output = out
+	logger.errOutput = errOut
+
+	ctx := context.WithValue(context.Background(), RequestIDKey, "1234")
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				logger.Info(ctx, LogCatDebug, "info")
+				logger.Warnf(ctx, LogCatDebug, "warn %d", i)
+				logger.ErrorWF(ctx, LogCatDebug, &Fields{"step": i})
+			}
+		}()
+	}
+
+	assertion.NoError(t, logger.SetOutputFile(filepath.Join(t.TempDir(), "stress.log")))
+	wg.Wait()
+
+	assert := assertion.New(t)
+	outLines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	errLines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+	assert.Len(outLines, 2*goroutines*iterations)
+	assert.Len(errLines, goroutines*iterations)
+	for _, line := range errLines {
+		assert.True(strings.HasPrefix(line, prefixError), line)
+	}
+}
+
+func TestCloseOutputFile(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+	path := filepath.Join(t.TempDir(), "api.log")
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	assert.NoError(logger.SetOutputFile(path))
+	logger.Info(ctx, LogCatDebug, "to file")
+	assert.NoError(logger.Sync())
+	assert.NoError(logger.Close())
+	logger.Info(ctx, LogCatDebug, "after close")
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Contains(string(data), "to file")
+	assert.NotContains(string(data), "after close")
+
+	assert.Contains(out.String(), "to file")
+	assert.Contains(out.String(), "after close")
+	assert.Equal(out, logger.output)
+	assert.NoError(logger.Close())
+}
+
+func TestFatalSyncsOutputFile(t *testing.T) {
+	exits := 0
+	exit = func(int) { exits++ }
+	defer func() { exit = os.Exit }()
+
+	logger := New()
+	logger.errOutput = &syncBuffer{}
+	path := filepath.Join(t.TempDir(), "api.log")
+	assert := assertion.New(t)
+
+	assert.NoError(logger.SetOutputFile(path))
+	defer logger.Close()
+	logger.Fatal(context.Background(), LogCatDebug, "fatal")
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(1, exits)
+	assert.True(strings.HasPrefix(string(data), "FATAL "), string(data))
+}
+
+func TestReopenOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported")
+	}
+
+	logger := New()
+	logger.output = &syncBuffer{}
+	path := filepath.Join(t.TempDir(), "api.log")
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	assert.NoError(logger.SetOutputFile(path))
+	defer logger.Close()
+	stop := logger.ReopenOnSignal(syscall.SIGUSR1)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				logger.Info(ctx, LogCatDebug, "line")
+			}
+		}()
+	}
+
+	// what logrotate does while the service logs
+	assert.NoError(os.Rename(path, path+".1"))
+	process, err := os.FindProcess(os.Getpid())
+	assert.NoError(err)
+	assert.NoError(process.Signal(syscall.SIGUSR1))
+	assert.Eventually(func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+	wg.Wait()
+
+	var content string
+	for _, name := range []string{path + ".1", path} {
+		data, err := ioutil.ReadFile(name)
+		assert.NoError(err)
+		content += string(data)
+	}
+	assert.Equal(400, strings.Count(content, "\n"))
+	assert.Equal(400, strings.Count(content, "INFO "))
+}
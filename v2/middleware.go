@@ -0,0 +1,254 @@
+package apilogger
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers and cookie read by the middleware.
+const (
+	apiKeyHeader      = "api-key"
+	requestIDHeader   = "x-request-id"
+	sessionName       = "session"
+	traceparentHeader = "traceparent"
+)
+
+// MiddlewareConfig configures the middleware returned by Logger.Middleware.
+type MiddlewareConfig struct {
+	// SessionHeader and SessionCookie are the names of the request
+	// header and cookie holding the session id, both "session" when
+	// empty. The header is used when both are set.
+	SessionHeader string
+	SessionCookie string
+
+	// TrustProxy takes the client ip from the X-Forwarded-For or
+	// X-Real-IP headers, set by a reverse proxy. It must only be
+	// enabled behind one, as clients can send these headers too.
+	TrustProxy bool
+
+	// SkipAccessLog disables the line logged once the request is served.
+	SkipAccessLog bool
+}
+
+// Middleware returns a net/http middleware setting the api-key,
+// request id, client address, session id and start time of the
+// context of every request, from the api-key, x-request-id
+// and session headers, the session cookie and the client ip. A
+// request id is generated when the request has none, or when it is
+// longer than 128 characters or holds anything but letters, digits,
+// '.', '_' and '-', and is sent back in the x-request-id header of
+// the response. The trace context of a valid traceparent header is
+// set too, so the lines of the request have its trace_id, span_id
+// and trace_flags. Once the request is served an access line is
+// logged with the LogCatReqPath category, holding the method, path,
+// status, bytes written and latency, as an error for 5xx statuses.
+func (l *Logger) Middleware(cfg MiddlewareConfig) func(http.Handler) http.Handler {
+	if cfg.SessionHeader == "" {
+		cfg.SessionHeader = sessionName
+	}
+	if cfg.SessionCookie == "" {
+		cfg.SessionCookie = sessionName
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(requestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, requestID)
+
+			session := r.Header.Get(cfg.SessionHeader)
+			if session == "" {
+				if cookie, err := r.Cookie(cfg.SessionCookie); err == nil {
+					session = cookie.Value
+				}
+			}
+
+			ctx := r.Context()
+			ctx = WithAPIKey(ctx, r.Header.Get(apiKeyHeader))
+			ctx = WithRequestID(ctx, requestID)
+			ctx = WithRemoteAddr(ctx, clientIP(r, cfg.TrustProxy))
+			ctx = WithSessionID(ctx, session)
+			ctx = WithStartTime(ctx, start)
+			// an invalid traceparent is ignored
+			ctx, _ = WithTraceparent(ctx, r.Header.Get(traceparentHeader))
+
+			rw, wrapped := wrapResponseWriter(w)
+			served := false
+			if !cfg.SkipAccessLog {
+				// deferred, so a handler that panics still gets its line
+				defer func() { l.accessLog(ctx, r, rw, start, !served) }()
+			}
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+			served = true
+		})
+	}
+}
+
+// accessLog logs the access line of the request. The status of a
+// handler that panicked before writing anything is logged as 500.
+func (l *Logger) accessLog(ctx context.Context, r *http.Request, rw *responseWriter, start time.Time, panicked bool) {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+		if panicked {
+			status = http.StatusInternalServerError
+		}
+	}
+
+	fields := &Fields{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"status":  status,
+		"bytes":   rw.bytes,
+		"latency": time.Since(start).String(),
+	}
+	if status >= http.StatusInternalServerError {
+		l.ErrorWF(ctx, LogCatReqPath, fields)
+	} else {
+		l.InfoWF(ctx, LogCatReqPath, fields)
+	}
+}
+
+// maxRequestIDLen is the length of the longest request id accepted.
+const maxRequestIDLen = 128
+
+// validRequestID reports whether the request id sent by a client is
+// short and only made of letters, digits, '.', '_' and '-', as it is
+// echoed in the response and usually passed on to other services.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request id of 32 hex digits.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Println("Failed to generate request id", err)
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// clientIP returns the ip of the client of the request, the first
+// address of X-Forwarded-For or X-Real-IP when proxies are trusted.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseWriter records the status and the
+// number of bytes of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// wrapResponseWriter returns the recorder of the response written
+// to w, and the writer handed to the handler. The latter implements
+// http.Flusher and http.Hijacker only when w does, so handlers
+// checking for them behave as they would without the middleware.
+func wrapResponseWriter(w http.ResponseWriter) (*responseWriter, http.ResponseWriter) {
+	rw := &responseWriter{ResponseWriter: w}
+
+	_, canFlush := w.(http.Flusher)
+	_, canHijack := w.(http.Hijacker)
+	switch {
+	case canFlush && canHijack:
+		return rw, flushHijackWriter{rw}
+	case canFlush:
+		return rw, flushWriter{rw}
+	case canHijack:
+		return rw, hijackWriter{rw}
+	default:
+		return rw, rw
+	}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += n
+	return n, err
+}
+
+func (w *responseWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && w.status == 0 {
+		// the handler takes over the connection, to upgrade it
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flushWriter, hijackWriter and flushHijackWriter add the
+// optional interfaces of the wrapped writer to a responseWriter.
+type flushWriter struct{ *responseWriter }
+
+func (w flushWriter) Flush() { w.flush() }
+
+type hijackWriter struct{ *responseWriter }
+
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type flushHijackWriter struct{ *responseWriter }
+
+func (w flushHijackWriter) Flush() { w.flush() }
+
+func (w flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
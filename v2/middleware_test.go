@@ -0,0 +1,249 @@
+package apilogger
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	out, errOut := &syncBuffer{}, &syncBuffer{}
+	logger := New()
+	logger.output = out
+	logger.errOutput = errOut
+
+	var ctx context.Context
+	handler := logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/users?debug=1", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	req.Header.Set("api-key", "key1")
+	req.Header.Set("x-request-id", "req1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "cookie1"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert := assertion.New(t)
+	assert.Equal("req1", rec.Header().Get("x-request-id"))
+	assert.Equal("key1", APIKeyFrom(ctx))
+	assert.Equal("req1", RequestIDFrom(ctx))
+	assert.Equal("10.0.0.7", RemoteAddrFrom(ctx))
+	assert.Equal("cookie1", SessionIDFrom(ctx))
+	assert.WithinDuration(time.Now(), StartTimeFrom(ctx), time.Minute)
+
+	line := out.String()
+	assert.True(strings.HasPrefix(line, prefixInfo), line)
+	for _, want := range []string{
+		`requestId="req1"`, `clientIp="10.0.0.7"`, `apiKey="key1"`, `sessionId="cookie1"`,
+		`code="REQ003"`, `method="POST"`, `path="/users"`, `status="201"`, `bytes="7"`, `latency="`,
+	} {
+		assert.Contains(line, want)
+	}
+	assert.Empty(errOut.String())
+}
+
+func TestMiddlewareDefaults(t *testing.T) {
+	out, errOut := &syncBuffer{}, &syncBuffer{}
+	logger := New()
+	logger.output = out
+	logger.errOutput = errOut
+
+	var ctx context.Context
+	handler := logger.Middleware(MiddlewareConfig{TrustProxy: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("session", "header1")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "cookie1"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert := assertion.New(t)
+	requestID := rec.Header().Get("x-request-id")
+	assert.Len(requestID, 32)
+	assert.Equal(requestID, RequestIDFrom(ctx))
+	assert.Equal("header1", SessionIDFrom(ctx))
+	assert.Equal("203.0.113.9", RemoteAddrFrom(ctx))
+
+	// 5xx responses are logged as errors
+	assert.Empty(out.String())
+	assert.True(strings.HasPrefix(errOut.String(), prefixError), errOut.String())
+	assert.Contains(errOut.String(), `status="500"`)
+	assert.Contains(errOut.String(), `requestId="`+requestID+`"`)
+
+	// a handler writing nothing responds 200
+	handler = logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/empty", nil))
+	assert.Contains(out.String(), `status="200"`)
+	assert.Contains(out.String(), `bytes="0"`)
+	assert.NotEqual(requestID, newRequestID())
+}
+
+func TestMiddlewareUpgrade(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+
+	handler := logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		_ = buf.Flush()
+
+		// echo the first line sent over the upgraded connection
+		line, _ := buf.ReadString('\n')
+		_, _ = buf.WriteString(line)
+		_ = buf.Flush()
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n"))
+	assertion.NoError(t, err)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if !assertion.NoError(t, err) {
+		return
+	}
+	assert := assertion.New(t)
+	assert.Equal(http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, err = conn.Write([]byte("ping\n"))
+	assert.NoError(err)
+	echo, err := r.ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("ping\n", echo)
+
+	// the access line is logged once the handler returns
+	assert.Eventually(func() bool { return strings.Contains(out.String(), `status="101"`) }, 5*time.Second, 10*time.Millisecond)
+}
+
+// plainResponseWriter implements none of the optional interfaces.
+type plainResponseWriter struct {
+	header http.Header
+}
+
+func (w *plainResponseWriter) Header() http.Header         { return w.header }
+func (w *plainResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *plainResponseWriter) WriteHeader(int)             {}
+
+func TestMiddlewareResponseWriterInterfaces(t *testing.T) {
+	logger := New()
+	logger.output = &syncBuffer{}
+
+	var flusher, hijacker bool
+	handler := logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+	}))
+
+	assert := assertion.New(t)
+	handler.ServeHTTP(&plainResponseWriter{header: http.Header{}}, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(flusher)
+	assert.False(hijacker)
+
+	// httptest.ResponseRecorder is a flusher only
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(flusher)
+	assert.False(hijacker)
+}
+
+func TestMiddlewareHostileRequestID(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+	handler := logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	assert := assertion.New(t)
+	for _, hostile := range []string{
+		`req1", apiKey="forged`,
+		"req1\nINFO 2021/03/23 23:37:40 forged line",
+		strings.Repeat("a", maxRequestIDLen+1),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header[http.CanonicalHeaderKey("x-request-id")] = []string{hostile}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		requestID := rec.Header().Get("x-request-id")
+		assert.Len(requestID, 32)
+		assert.NotContains(out.String(), "forged")
+		assert.NotContains(out.String(), hostile)
+	}
+
+	// the ids of other services are kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("x-request-id", "1-5759e988_bd862e3f.fe1-c8d2")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal("1-5759e988_bd862e3f.fe1-c8d2", rec.Header().Get("x-request-id"))
+}
+
+func TestMiddlewareHostileHeaders(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+	handler := logger.Middleware(MiddlewareConfig{TrustProxy: true})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users%22,%20code=%22EVIL%0AINFO%20forged", nil)
+	req.Header.Set("api-key", `key1", apiKey="forged`)
+	req.Header.Set("session", "s1\nINFO 2021/03/23 23:37:40 forged line")
+	req.Header.Set("X-Forwarded-For", `10.0.0.7", clientIp="forged`)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := out.String()
+	assert := assertion.New(t)
+	assert.Equal(1, strings.Count(line, "\n"), line)
+	for _, forged := range []string{`apiKey="forged"`, `clientIp="forged"`, `code="EVIL"`, "\nINFO"} {
+		assert.NotContains(strings.TrimSuffix(line, "\n"), forged)
+	}
+	assert.Contains(line, `apiKey="key1\", apiKey=\"forged"`)
+	assert.Contains(line, `sessionId="s1\nINFO 2021/03/23 23:37:40 forged line"`)
+	assert.Contains(line, `path="/users\", code=\"EVIL\nINFO forged"`)
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	errOut := &syncBuffer{}
+	logger := New()
+	logger.output = &syncBuffer{}
+	logger.errOutput = errOut
+	handler := logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	assert := assertion.New(t)
+	assert.PanicsWithValue("boom", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+	assert.Contains(errOut.String(), `path="/panic"`)
+	assert.Contains(errOut.String(), `status="500"`)
+}
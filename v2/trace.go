@@ -0,0 +1,69 @@
+package apilogger
+
+import (
+	"errors"
+	"strconv"
+)
+
+// traceContext is the trace context of a traceparent
+// value, its ids written as lowercase hex digits.
+type traceContext struct {
+	traceID string
+	spanID  string
+	flags   string
+}
+
+// traceparent returns the trace context as a version 00 traceparent value.
+func (tc traceContext) traceparent() string {
+	if tc.traceID == "" {
+		return ""
+	}
+	return "00-" + tc.traceID + "-" + tc.spanID + "-" + tc.flags
+}
+
+// parseTraceparent parses a traceparent header value. Values of a
+// later version than 00 are accepted as long as they start with the
+// fields of version 00, as the recommendation requires.
+func parseTraceparent(s string) (traceContext, error) {
+	invalid := errors.New("apilogger: invalid traceparent " + strconv.Quote(s))
+
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return traceContext{}, invalid
+	}
+	version := s[:2]
+	if !isLowerHex(version) || version == "ff" {
+		return traceContext{}, invalid
+	}
+	if len(s) > 55 && (version == "00" || s[55] != '-') {
+		return traceContext{}, invalid
+	}
+
+	tc := traceContext{traceID: s[3:35], spanID: s[36:52], flags: s[53:55]}
+	if !isLowerHex(tc.traceID) || !isLowerHex(tc.spanID) || !isLowerHex(tc.flags) {
+		return traceContext{}, invalid
+	}
+	if isZeroHex(tc.traceID) || isZeroHex(tc.spanID) {
+		return traceContext{}, invalid
+	}
+	return tc, nil
+}
+
+// isLowerHex reports whether s is only made of lowercase hex digits.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isZeroHex reports whether s is only made of zeros.
+func isZeroHex(s string) bool {
+	for _, c := range s {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package apilogger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestWithTraceparent(t *testing.T) {
+	assert := assertion.New(t)
+
+	ctx, err := WithTraceparent(context.Background(), testTraceparent)
+	assert.NoError(err)
+	assert.Equal(testTraceparent, TraceparentFrom(ctx))
+	assert.Empty(TraceparentFrom(context.Background()))
+
+	// later versions may add fields
+	ctx, err = WithTraceparent(context.Background(), "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.NoError(err)
+	assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", TraceparentFrom(ctx))
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		`00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0", apiKey="x`,
+	} {
+		ctx, err := WithTraceparent(context.Background(), invalid)
+		assert.Error(err, invalid)
+		assert.Empty(TraceparentFrom(ctx), invalid)
+	}
+}
+
+func TestLoggerTraceparent(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+	assert := assertion.New(t)
+
+	ctx, _ := WithTraceparent(context.Background(), testTraceparent)
+	logger.Info(ctx, LogCatDebug, "traced")
+	logger.InfoWF(ctx, LogCatDebug, &Fields{"rows": 2})
+	trace := `type="debug", trace_id="4bf92f3577b34da6a3ce929d0e0e4736", span_id="00f067aa0ba902b7", trace_flags="01", `
+	assert.Contains(out.String(), trace+`message="traced"`)
+	assert.Contains(out.String(), trace+`rows="2"`)
+
+	untraced := &syncBuffer{}
+	logger = New()
+	logger.output = untraced
+	logger.Info(context.Background(), LogCatDebug, "untraced")
+	assert.NotContains(untraced.String(), "trace_id")
+}
+
+func TestMiddlewareTraceparent(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+
+	var ctx context.Context
+	handler := logger.Middleware(MiddlewareConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	assert := assertion.New(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(testTraceparent, TraceparentFrom(ctx))
+	assert.Contains(out.String(), `trace_id="4bf92f3577b34da6a3ce929d0e0e4736"`)
+
+	// an invalid header is ignored
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "garbage")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(TraceparentFrom(ctx))
+}
@@ -0,0 +1,169 @@
+package apilogger
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Overflow is what an asynchronous Logger does with
+// entries logged while its queue is full.
+type Overflow int
+
+const (
+	// OverflowBlock waits for room in the queue,
+	// so no entry is lost.
+	OverflowBlock Overflow = iota
+
+	// OverflowDropOldest discards the oldest queued entry.
+	OverflowDropOldest
+
+	// OverflowDropNewest discards the entry being logged.
+	OverflowDropNewest
+)
+
+// WithAsync makes the Logger queue entries in a ring buffer of the
+// given size, encoding and writing them in a background goroutine so
+// log calls do not wait for the outputs. Queued entries are written
+// before Sync and Close return and before Fatal exits. Field values
+// are encoded in the background, so they must not be changed once
+// logged.
+func WithAsync(size int, overflow Overflow) Option {
+	return func(l *Logger) {
+		if size < 1 {
+			size = 1
+		}
+		l.async = &asyncQueue{
+			entries:  make([]*Entry, size),
+			overflow: overflow,
+			done:     make(chan struct{}),
+		}
+		l.async.cond = sync.NewCond(&l.async.mu)
+		go l.drain()
+	}
+}
+
+// asyncQueue is the bounded queue of the entries
+// waiting to be written by an asynchronous Logger.
+type asyncQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	entries []*Entry
+	// head is the index of the oldest entry and n their number
+	head, n int
+	// writing is set while the last taken entry is written
+	writing bool
+	closed  bool
+
+	overflow Overflow
+	// dropped is the number of discarded entries, accessed atomically
+	dropped uint64
+
+	// done is closed once the queue is drained after close
+	done chan struct{}
+}
+
+// put queues the entry. It returns false when the
+// queue is closed and the entry was not queued.
+func (q *asyncQueue) put(e *Entry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.n == len(q.entries) && !q.closed {
+		switch q.overflow {
+		case OverflowDropNewest:
+			atomic.AddUint64(&q.dropped, 1)
+			return true
+		case OverflowDropOldest:
+			q.entries[q.head] = nil
+			q.head = (q.head + 1) % len(q.entries)
+			q.n--
+			atomic.AddUint64(&q.dropped, 1)
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.closed {
+		return false
+	}
+
+	q.entries[(q.head+q.n)%len(q.entries)] = e
+	q.n++
+	q.cond.Broadcast()
+	return true
+}
+
+// take waits for an entry and removes it from the queue. It
+// returns false once the queue is closed and empty. The entry
+// counts as pending until written is called.
+func (q *asyncQueue) take() (*Entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.n == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.n == 0 {
+		return nil, false
+	}
+
+	e := q.entries[q.head]
+	q.entries[q.head] = nil
+	q.head = (q.head + 1) % len(q.entries)
+	q.n--
+	q.writing = true
+	q.cond.Broadcast()
+	return e, true
+}
+
+// written reports the entry returned by take as written.
+func (q *asyncQueue) written() {
+	q.mu.Lock()
+	q.writing = false
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// flush waits until all the queued entries are written.
+func (q *asyncQueue) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.n > 0 || q.writing {
+		q.cond.Wait()
+	}
+}
+
+// close stops accepting entries and waits
+// until the queued ones are written.
+func (q *asyncQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	<-q.done
+}
+
+// drain writes the queued entries until the queue is closed.
+func (l *Logger) drain() {
+	defer close(l.async.done)
+
+	for {
+		e, ok := l.async.take()
+		if !ok {
+			return
+		}
+		l.writeEntry(e)
+		l.async.written()
+	}
+}
+
+// Dropped returns the number of entries discarded because the
+// queue of an asynchronous Logger was full, see WithAsync.
+func (l *Logger) Dropped() uint64 {
+	if l.async == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.async.dropped)
+}
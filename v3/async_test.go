@@ -0,0 +1,154 @@
+package apilogger
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// blockingWriter blocks every write until it is released,
+// reporting on entered when a write starts.
+type blockingWriter struct {
+	syncBuffer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{
+		entered: make(chan struct{}, 100),
+		release: make(chan struct{}),
+	}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.release
+	return w.syncBuffer.Write(p)
+}
+
+// messages returns the messages of the text lines in s.
+func messages(s string) []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		i := strings.Index(line, `message="`)
+		msgs = append(msgs, strings.TrimSuffix(line[i+len(`message="`):], `"`))
+	}
+	return msgs
+}
+
+func TestAsyncLogging(t *testing.T) {
+	const goroutines, iterations = 8, 200
+
+	out := &syncBuffer{}
+	logger := New(WithAsync(16, OverflowBlock))
+	logger.output = out
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				logger.Infof(ctx, LogCatDebug, StatusCatDebug, "line %d", i)
+			}
+		}()
+	}
+	wg.Wait()
+	assertion.NoError(t, logger.Close())
+
+	// written synchronously once closed
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "closed")
+
+	assert := assertion.New(t)
+	lines := messages(out.String())
+	assert.Len(lines, goroutines*iterations+1)
+	assert.Equal("closed", lines[len(lines)-1])
+	assert.Equal(uint64(0), logger.Dropped())
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	tests := []struct {
+		overflow Overflow
+		expected []string
+	}{
+		{OverflowDropNewest, []string{"0", "1", "2"}},
+		{OverflowDropOldest, []string{"0", "3", "4"}},
+	}
+
+	for _, test := range tests {
+		out := newBlockingWriter()
+		logger := New(WithAsync(2, test.overflow))
+		logger.output = out
+		ctx := context.Background()
+
+		logger.Info(ctx, LogCatDebug, StatusCatDebug, "0")
+		// the first entry is being written, the queue is empty
+		<-out.entered
+		for _, msg := range []string{"1", "2", "3", "4"} {
+			logger.Info(ctx, LogCatDebug, StatusCatDebug, msg)
+		}
+		close(out.release)
+		assertion.NoError(t, logger.Close())
+
+		assertion.Equal(t, test.expected, messages(out.String()))
+		assertion.Equal(t, uint64(2), logger.Dropped())
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	out := newBlockingWriter()
+	logger := New(WithAsync(1, OverflowBlock))
+	logger.output = out
+	ctx := context.Background()
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "0")
+	<-out.entered
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "1")
+
+	logged := make(chan struct{})
+	go func() {
+		logger.Info(ctx, LogCatDebug, StatusCatDebug, "2")
+		close(logged)
+	}()
+
+	select {
+	case <-logged:
+		t.Fatal("logged while the queue was full")
+	default:
+	}
+	close(out.release)
+	<-logged
+	assertion.NoError(t, logger.Close())
+
+	assertion.Equal(t, []string{"0", "1", "2"}, messages(out.String()))
+	assertion.Equal(t, uint64(0), logger.Dropped())
+}
+
+func TestAsyncFatalDrains(t *testing.T) {
+	out, errOut := &syncBuffer{}, &syncBuffer{}
+	logger := New(WithAsync(8, OverflowBlock))
+	logger.output = out
+	logger.errOutput = errOut
+	ctx := context.Background()
+
+	var written, fatal []string
+	exit = func(int) {
+		written = messages(out.String())
+		fatal = messages(errOut.String())
+	}
+	t.Cleanup(func() { exit = osExit })
+
+	for i := 0; i < 100; i++ {
+		logger.Infof(ctx, LogCatDebug, StatusCatDebug, "%d", i)
+	}
+	logger.Fatal(ctx, LogCatDebug, StatusCatFailed, "fatal")
+
+	assertion.Len(t, written, 100)
+	assertion.Equal(t, []string{"fatal"}, fatal)
+	assertion.NoError(t, logger.Close())
+}
@@ -0,0 +1,320 @@
+package apilogger
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BatchConfig sets when the entries buffered by a shipping sink
+// are sent and how failed sends are retried.
+type BatchConfig struct {
+	// MaxEntries sends the batch once it holds that many
+	// entries, 500 when zero.
+	MaxEntries int
+
+	// MaxBytes sends the batch once its entries reach that
+	// size, 1 MiB when zero.
+	MaxBytes int
+
+	// Interval sends the batch that long after its first
+	// entry, even if it is not full, 1s when zero.
+	Interval time.Duration
+
+	// MaxRetries is the number of times a failed send is retried,
+	// 5 when zero and none when negative.
+	MaxRetries int
+
+	// MinBackoff is the delay before the first retry, doubled for
+	// every following one up to MaxBackoff, and randomized ("full
+	// jitter"). 100ms and 30s when zero. The Retry-After asked by
+	// a server answering 429 or 503 is used instead, up to
+	// MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnError is called with the error and the number of entries
+	// lost when a batch is dropped, after its retries or because
+	// the error is not worth retrying. The error is logged with
+	// the standard logger when nil.
+	OnError func(err error, entries int)
+}
+
+func (c BatchConfig) withDefaults() BatchConfig {
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 500
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 1 << 20
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 5
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 30 * time.Second
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = c.MinBackoff
+	}
+	return c
+}
+
+// backoff returns the randomized delay before the given retry.
+func (c BatchConfig) backoff(retry int) time.Duration {
+	d := c.MaxBackoff
+	if retry < 32 {
+		if exp := c.MinBackoff << uint(retry); exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// delay returns the delay before the given retry of a send that
+// failed with err: the Retry-After asked by the server, up to
+// MaxBackoff, when there is one and the backoff otherwise.
+func (c BatchConfig) delay(retry int, err error) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		if httpErr.RetryAfter > c.MaxBackoff {
+			return c.MaxBackoff
+		}
+		return httpErr.RetryAfter
+	}
+	return c.backoff(retry)
+}
+
+// permanentError marks an error that is not worth retrying,
+// e.g. a request rejected by the server.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so it is not retried.
+func permanent(err error) error {
+	return &permanentError{err}
+}
+
+// batchItem is an entry buffered by a batcher,
+// in the form expected by its send function.
+type batchItem struct {
+	value interface{}
+	size  int
+}
+
+// batchMsg is a batch handed to the sending goroutine, done
+// is closed once it is sent, when someone waits for it.
+type batchMsg struct {
+	items []batchItem
+	done  chan struct{}
+}
+
+// batcher buffers items and sends them in batches from a single
+// goroutine, retrying failed sends with exponential backoff. It
+// is the engine of the shipping sinks.
+type batcher struct {
+	cfg  BatchConfig
+	send func(items []batchItem) error
+
+	mu      sync.Mutex
+	items   []batchItem
+	size    int
+	started time.Time
+	closed  bool
+
+	// queueMu is held for reading while handing a batch over
+	// and for writing while closing the queue
+	queueMu sync.RWMutex
+	queue   chan batchMsg
+	done    chan struct{}
+}
+
+// newBatcher starts a batcher sending its batches with send.
+func newBatcher(cfg BatchConfig, send func(items []batchItem) error) *batcher {
+	b := &batcher{
+		cfg:   cfg.withDefaults(),
+		send:  send,
+		queue: make(chan batchMsg, 4),
+		done:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add buffers the item, handing the batch over to the sending
+// goroutine once it is full. It blocks while 4 full batches
+// are waiting to be sent.
+func (b *batcher) add(value interface{}, size int) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errWriterClosed
+	}
+
+	if len(b.items) == 0 {
+		b.started = time.Now()
+	}
+	b.items = append(b.items, batchItem{value, size})
+	b.size += size
+
+	if len(b.items) < b.cfg.MaxEntries && b.size < b.cfg.MaxBytes {
+		b.mu.Unlock()
+		return nil
+	}
+	items := b.take()
+	b.handOver(batchMsg{items: items})
+	return nil
+}
+
+// handOver hands the batch over to the sending goroutine. It must be
+// called with mu held, and releases it, so the queue is not closed
+// in between.
+func (b *batcher) handOver(msg batchMsg) {
+	b.queueMu.RLock()
+	b.mu.Unlock()
+
+	b.queue <- msg
+	b.queueMu.RUnlock()
+}
+
+// take removes the buffered items. It must be called with mu held.
+func (b *batcher) take() []batchItem {
+	items := b.items
+	b.items = nil
+	b.size = 0
+	return items
+}
+
+// flush sends the buffered items and waits until
+// every batch handed over so far is sent.
+func (b *batcher) flush() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	b.handOver(batchMsg{items: b.take(), done: done})
+	<-done
+}
+
+// close sends the buffered items and stops the sending goroutine.
+func (b *batcher) close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errWriterClosed
+	}
+	b.closed = true
+	items := b.take()
+	b.mu.Unlock()
+
+	// waits for the batches being handed over
+	b.queueMu.Lock()
+	b.queue <- batchMsg{items: items}
+	close(b.queue)
+	b.queueMu.Unlock()
+
+	<-b.done
+	return nil
+}
+
+// run sends the batches handed over, and the buffered items
+// once they waited for the interval.
+func (b *batcher) run() {
+	defer close(b.done)
+
+	tick := b.cfg.Interval / 4
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-b.queue:
+			if !ok {
+				return
+			}
+			b.sendWithRetries(msg.items)
+			if msg.done != nil {
+				close(msg.done)
+			}
+
+		case <-ticker.C:
+			b.mu.Lock()
+			var items []batchItem
+			if len(b.items) > 0 && time.Since(b.started) >= b.cfg.Interval {
+				items = b.take()
+			}
+			b.mu.Unlock()
+			b.sendWithRetries(items)
+		}
+	}
+}
+
+// partialError is returned by a send function when only some of the
+// items were accepted: rejected items are dropped and retry items,
+// when the error is not permanent, are sent again.
+type partialError struct {
+	err      error
+	rejected int
+	retry    []batchItem
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// sendWithRetries sends the items, retrying failed sends,
+// and reports the batch as lost when they all failed.
+func (b *batcher) sendWithRetries(items []batchItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	var err error
+	for retry := 0; ; retry++ {
+		if err = b.send(items); err == nil {
+			return
+		}
+
+		var partial *partialError
+		if errors.As(err, &partial) {
+			if partial.rejected > 0 {
+				b.lost(partial.err, partial.rejected)
+			}
+			if items = partial.retry; len(items) == 0 {
+				return
+			}
+			err = partial.err
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) || retry >= b.cfg.MaxRetries {
+			break
+		}
+		time.Sleep(b.cfg.delay(retry, err))
+	}
+	b.lost(err, len(items))
+}
+
+// lost reports entries dropped after err.
+func (b *batcher) lost(err error, entries int) {
+	if b.cfg.OnError != nil {
+		b.cfg.OnError(err, entries)
+		return
+	}
+	log.Println("Failed to send log entries, dropped", entries, err)
+}
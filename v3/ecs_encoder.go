@@ -0,0 +1,87 @@
+package apilogger
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// ecsVersion is the version of the Elastic Common Schema
+// the entries of an ECSEncoder follow.
+const ecsVersion = "8.11.0"
+
+// ECSEncoder renders every entry as a JSON document of the Elastic
+// Common Schema, one per line: @timestamp, log.level, message,
+// event.code and event.category from the LogCat, event.outcome from
+// the status, trace.id from the uuid and log.origin from the caller.
+// Entries logged in a span have the trace.id and span.id of the span
+// instead, the uuid being written as labels.uuid. Fields are written
+// as "fields.<name>".
+type ECSEncoder struct{}
+
+// Encode implements Encoder.
+func (ECSEncoder) Encode(w io.Writer, e *Entry) error {
+	var buf bytes.Buffer
+	writeJSONLine(&buf, ecsDocument(e))
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ecsDocument returns the ECS fields of the entry, without the empty ones.
+func ecsDocument(e *Entry) []jsonField {
+	doc := []jsonField{
+		{"@timestamp", e.Time.UTC().Format(jsonTimeFormat)},
+		{"log.level", strings.ToLower(e.Level.String())},
+		{"message", e.Message},
+		{"ecs.version", ecsVersion},
+		{"event.code", e.LogCat.Code},
+		{"event.category", e.LogCat.Type},
+		{"event.outcome", ecsOutcome(e.Status)},
+		{"trace.id", e.Context.UUID},
+		{"labels.taskName", e.Context.TaskName},
+		{"log.origin.file.name", e.Caller.File},
+		{"log.origin.file.line", e.Caller.Line},
+		{"log.origin.function", e.Caller.Function},
+	}
+	if e.Trace.IsValid() {
+		doc[7] = jsonField{"trace.id", e.Trace.TraceIDString()}
+		doc = append(doc,
+			jsonField{"span.id", e.Trace.SpanIDString()},
+			jsonField{"labels.uuid", e.Context.UUID},
+		)
+	}
+	if elapsed := e.Elapsed(); elapsed > 0 {
+		// event.duration is in nanoseconds
+		doc = append(doc, jsonField{"event.duration", elapsed.Nanoseconds()})
+	}
+
+	fields := doc[:0]
+	for _, f := range doc {
+		if s, ok := f.value.(string); ok && s == "" {
+			continue
+		}
+		if n, ok := f.value.(int); ok && n == 0 {
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	for _, k := range sortedKeys(e.Fields) {
+		fields = append(fields, jsonField{"fields." + k, e.Fields[k]})
+	}
+	return fields
+}
+
+// ecsOutcome returns the event.outcome of the status.
+func ecsOutcome(status StatusCat) string {
+	switch status {
+	case StatusCatPassed:
+		return "success"
+	case StatusCatFailed:
+		return "failure"
+	default:
+		return "unknown"
+	}
+}
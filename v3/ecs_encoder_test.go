@@ -0,0 +1,89 @@
+package apilogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// ecsRecord encodes the entry with the ECSEncoder and decodes it back.
+func ecsRecord(t *testing.T, e *Entry) map[string]interface{} {
+	var buf bytes.Buffer
+	if err := (ECSEncoder{}).Encode(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestECSEncoder(t *testing.T) {
+	e := testEntry(LogCatStartUp)
+	e.Status = StatusCatPassed
+	e.Message = "started"
+	e.Time = time.Date(2024, 3, 1, 10, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	e.Context.StartTime = e.Time.Add(-1500 * time.Millisecond)
+	e.Caller = Caller{File: "main.go", Line: 42, Function: "main.main"}
+	record := ecsRecord(t, e)
+	assert := assertion.New(t)
+
+	assert.Equal("2024-03-01T15:30:00.000Z", record["@timestamp"])
+	assert.Equal("info", record["log.level"])
+	assert.Equal("started", record["message"])
+	assert.Equal(LogCatStartUp.Code, record["event.code"])
+	assert.Equal(LogCatStartUp.Type, record["event.category"])
+	assert.Equal("success", record["event.outcome"])
+	assert.Equal(float64(1500*time.Millisecond), record["event.duration"])
+	assert.Equal("12345zw", record["trace.id"])
+	assert.Equal("UpdatePassword", record["labels.taskName"])
+	assert.Equal("main.go", record["log.origin.file.name"])
+	assert.Equal(float64(42), record["log.origin.file.line"])
+	assert.Equal("main.main", record["log.origin.function"])
+	assert.Contains(record, "ecs.version")
+}
+
+func TestECSEncoderOutcome(t *testing.T) {
+	tests := map[StatusCat]string{
+		StatusCatPassed:  "success",
+		StatusCatFailed:  "failure",
+		StatusCatPending: "unknown",
+		StatusCatDebug:   "unknown",
+	}
+
+	for status, outcome := range tests {
+		e := testEntry(LogCatDebug)
+		e.Status = status
+		assertion.Equal(t, outcome, ecsRecord(t, e)["event.outcome"], status.Type)
+	}
+}
+
+func TestECSEncoderFields(t *testing.T) {
+	e := testEntry(LogCatDebug)
+	e.Context = CtxKeys{}
+	e.Fields = Fields{"user": "ana", "attempts": 3}
+	record := ecsRecord(t, e)
+	assert := assertion.New(t)
+
+	assert.Equal("ana", record["fields.user"])
+	assert.Equal(float64(3), record["fields.attempts"])
+	for _, key := range []string{"message", "trace.id", "labels.taskName", "event.duration", "log.origin.file.line"} {
+		assert.NotContains(record, key)
+	}
+}
+
+func TestECSEncoderTraceContext(t *testing.T) {
+	e := testEntry(LogCatDebug)
+	e.Trace, _ = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	record := ecsRecord(t, e)
+	assert := assertion.New(t)
+
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", record["trace.id"])
+	assert.Equal("00f067aa0ba902b7", record["span.id"])
+	assert.Equal("12345zw", record["labels.uuid"])
+}
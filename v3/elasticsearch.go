@@ -0,0 +1,249 @@
+package apilogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ElasticsearchConfig configures an ElasticsearchWriter.
+type ElasticsearchConfig struct {
+	// URL of the cluster, e.g. https://elastic:9200.
+	URL string
+
+	// Index is the name of the index of the entries, in which the
+	// text between braces is a time layout formatted with the UTC
+	// time of the entry. "apilogger-{2006.01.02}" when empty, one
+	// index a day.
+	Index string
+
+	// Username and Password set basic authentication,
+	// APIKey an "Authorization: ApiKey" header instead.
+	Username string
+	Password string
+	APIKey   string
+
+	// Header is added to every request.
+	Header http.Header
+
+	// Client sends the requests, a client with a 10s
+	// timeout when nil.
+	Client *http.Client
+
+	// Batch sets the size of the batches and their retries.
+	Batch BatchConfig
+}
+
+// defaultIndex is the index of the entries when none is configured.
+const defaultIndex = "apilogger-{2006.01.02}"
+
+// ElasticsearchWriter is a sink writer indexing entries in Elasticsearch
+// with the bulk API, as documents of the Elastic Common Schema encoded
+// by an ECSEncoder, whatever the encoder of the sink. Documents refused
+// with a 429 or 5xx status are retried like a failed batch, the other
+// refused documents are dropped and reported to OnError.
+type ElasticsearchWriter struct {
+	cfg     ElasticsearchConfig
+	url     string
+	batcher *batcher
+}
+
+// esDocument is a document buffered by an ElasticsearchWriter.
+type esDocument struct {
+	index string
+	doc   []byte
+}
+
+// NewElasticsearchWriter returns an ElasticsearchWriter for the config.
+func NewElasticsearchWriter(cfg ElasticsearchConfig) (*ElasticsearchWriter, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("apilogger: elasticsearch sink without a url")
+	}
+	if cfg.Index == "" {
+		cfg.Index = defaultIndex
+	}
+	if strings.Count(cfg.Index, "{") != strings.Count(cfg.Index, "}") {
+		return nil, fmt.Errorf("apilogger: unbalanced braces in index %q", cfg.Index)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	w := &ElasticsearchWriter{cfg: cfg, url: strings.TrimSuffix(cfg.URL, "/") + "/_bulk"}
+	w.batcher = newBatcher(cfg.Batch, w.send)
+	return w, nil
+}
+
+// WriteEntry implements EntryWriter.
+func (w *ElasticsearchWriter) WriteEntry(e *Entry, p []byte) error {
+	var buf bytes.Buffer
+	writeJSONLine(&buf, ecsDocument(e))
+	return w.add(e.Time, buf.Bytes())
+}
+
+// Write implements io.Writer, indexing p, which
+// must hold a single JSON document.
+func (w *ElasticsearchWriter) Write(p []byte) (int, error) {
+	if err := w.add(time.Now(), bytes.TrimSpace(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *ElasticsearchWriter) add(t time.Time, doc []byte) error {
+	d := esDocument{
+		index: indexName(w.cfg.Index, t),
+		doc:   append([]byte(nil), doc...),
+	}
+	return w.batcher.add(d, len(d.index)+len(d.doc))
+}
+
+// Flush sends the current batch and waits until
+// every batch written so far is sent or dropped.
+func (w *ElasticsearchWriter) Flush() error {
+	w.batcher.flush()
+	return nil
+}
+
+// Close sends the current batch and stops the writer.
+func (w *ElasticsearchWriter) Close() error {
+	return w.batcher.close()
+}
+
+// indexName returns the index template formatted with t.
+func indexName(template string, t time.Time) string {
+	t = t.UTC()
+
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		end := strings.IndexByte(template, '}')
+		if start < 0 || end < start {
+			b.WriteString(template)
+			return b.String()
+		}
+		b.WriteString(template[:start])
+		b.WriteString(t.Format(template[start+1 : end]))
+		template = template[end+1:]
+	}
+}
+
+// esBulkResponse is the part of a bulk API response
+// reporting the documents that were refused.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// ElasticsearchError reports documents refused by a bulk request.
+type ElasticsearchError struct {
+	// Documents is the number of documents refused
+	Documents int
+	// Status, Type and Reason are those of the first one,
+	// Status is zero for documents missing from the response
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ElasticsearchError) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("apilogger: elasticsearch refused %d documents: %s", e.Documents, e.Reason)
+	}
+	return fmt.Sprintf("apilogger: elasticsearch refused %d documents: %d %s: %s",
+		e.Documents, e.Status, e.Type, e.Reason)
+}
+
+// send indexes the batch once.
+func (w *ElasticsearchWriter) send(items []batchItem) error {
+	var body bytes.Buffer
+	for _, item := range items {
+		d := item.value.(esDocument)
+		body.WriteString(`{"create":{"_index":`)
+		writeJSONValue(&body, d.index)
+		body.WriteString("}}\n")
+		body.Write(d.doc)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, &body)
+	if err != nil {
+		return permanent(err)
+	}
+	for k, vs := range w.cfg.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+w.cfg.APIKey)
+	} else if w.cfg.Username != "" {
+		req.SetBasicAuth(w.cfg.Username, w.cfg.Password)
+	}
+
+	resp, err := doBatchRequest(w.cfg.Client, req)
+	if err != nil {
+		return err
+	}
+
+	var bulk esBulkResponse
+	if err := json.Unmarshal(resp, &bulk); err != nil {
+		return permanent(fmt.Errorf("apilogger: invalid bulk response: %w", err))
+	}
+	if !bulk.Errors && len(bulk.Items) == len(items) {
+		return nil
+	}
+	return bulkFailures(items, &bulk)
+}
+
+// bulkFailures returns the error of a bulk request that refused
+// some documents, with those worth sending again. Documents
+// missing from the response are reported as refused, as
+// whether they were indexed is unknown.
+func bulkFailures(items []batchItem, bulk *esBulkResponse) error {
+	var esErr *ElasticsearchError
+	partial := &partialError{}
+	for i, result := range bulk.Items {
+		if i >= len(items) {
+			break
+		}
+		for _, r := range result {
+			if r.Status < 300 {
+				continue
+			}
+
+			if esErr == nil {
+				esErr = &ElasticsearchError{Status: r.Status, Type: r.Error.Type, Reason: r.Error.Reason}
+			}
+			esErr.Documents++
+			if r.Status >= 500 || r.Status == http.StatusTooManyRequests {
+				partial.retry = append(partial.retry, items[i])
+			} else {
+				partial.rejected++
+			}
+		}
+	}
+
+	if missing := len(items) - len(bulk.Items); missing > 0 {
+		if esErr == nil {
+			esErr = &ElasticsearchError{Reason: "missing from the bulk response"}
+		}
+		esErr.Documents += missing
+		partial.rejected += missing
+	}
+
+	if esErr == nil {
+		return nil
+	}
+	partial.err = esErr
+	return partial
+}
@@ -0,0 +1,216 @@
+package apilogger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// esDoc is a document received by fakeElasticsearch.
+type esDoc struct {
+	index string
+	doc   map[string]interface{}
+}
+
+// fakeElasticsearch is a stub bulk API recording the documents
+// it accepts. refuse returns the status to refuse a document with,
+// given the number of times it was received, 201 when it returns zero.
+type fakeElasticsearch struct {
+	mu       sync.Mutex
+	docs     []esDoc
+	requests int
+	auth     string
+	seen     map[string]int
+	refuse   func(message string, seen int) int
+}
+
+func (f *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	f.auth = r.Header.Get("Authorization")
+	if f.seen == nil {
+		f.seen = make(map[string]int)
+	}
+
+	var items []string
+	errored := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var action struct {
+			Create struct {
+				Index string `json:"_index"`
+			} `json:"create"`
+		}
+		var doc map[string]interface{}
+		if json.Unmarshal(scanner.Bytes(), &action) != nil || !scanner.Scan() ||
+			json.Unmarshal(scanner.Bytes(), &doc) != nil {
+			http.Error(w, "invalid bulk body", http.StatusBadRequest)
+			return
+		}
+
+		message, _ := doc["message"].(string)
+		f.seen[message]++
+		status := http.StatusCreated
+		if f.refuse != nil {
+			if s := f.refuse(message, f.seen[message]); s != 0 {
+				status = s
+			}
+		}
+
+		if status != http.StatusCreated {
+			errored = true
+			items = append(items, fmt.Sprintf(
+				`{"create":{"status":%d,"error":{"type":"refused","reason":"refused %s"}}}`, status, message))
+			continue
+		}
+		f.docs = append(f.docs, esDoc{action.Create.Index, doc})
+		items = append(items, `{"create":{"status":201}}`)
+	}
+
+	fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, errored, strings.Join(items, ","))
+}
+
+func (f *fakeElasticsearch) received() []esDoc {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]esDoc(nil), f.docs...)
+}
+
+func TestElasticsearchWriter(t *testing.T) {
+	f := &fakeElasticsearch{}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	w, err := NewElasticsearchWriter(ElasticsearchConfig{URL: server.URL + "/", APIKey: "secret", Batch: fastRetries})
+	assertion.NoError(t, err)
+
+	logger := New(WithSink(Sink{Name: "elastic", Writer: w}))
+	ctx := context.WithValue(context.Background(), ContextData, CtxKeys{UUID: "12345zw"})
+	logger.Info(ctx, LogCatCSV, StatusCatPassed, "imported")
+	logger.Error(ctx, LogCatSMTP, StatusCatFailed, "not sent")
+	_, err = w.Write([]byte(`{"message":"raw"}` + "\n"))
+	assertion.NoError(t, err)
+	assertion.NoError(t, logger.Sync())
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	docs := f.received()
+	if !assert.Len(docs, 3) {
+		return
+	}
+
+	index := "apilogger-" + time.Now().UTC().Format("2006.01.02")
+	assert.Equal(index, docs[0].index)
+	assert.Equal("info", docs[0].doc["log.level"])
+	assert.Equal("imported", docs[0].doc["message"])
+	assert.Equal("success", docs[0].doc["event.outcome"])
+	assert.Equal(LogCatCSV.Type, docs[0].doc["event.category"])
+	assert.Equal("12345zw", docs[0].doc["trace.id"])
+	assert.Equal("elasticsearch_test.go", docs[0].doc["log.origin.file.name"])
+	assert.Equal("error", docs[1].doc["log.level"])
+	assert.Equal("failure", docs[1].doc["event.outcome"])
+	assert.Equal("raw", docs[2].doc["message"])
+	assert.Equal("ApiKey secret", f.auth)
+}
+
+func TestElasticsearchWriterPartialFailures(t *testing.T) {
+	f := &fakeElasticsearch{refuse: func(message string, seen int) int {
+		switch {
+		case message == "invalid":
+			return http.StatusBadRequest
+		case message == "throttled" && seen <= 2:
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var failures []error
+	lost := 0
+	batch := fastRetries
+	batch.OnError = func(err error, entries int) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+		lost += entries
+	}
+	w, err := NewElasticsearchWriter(ElasticsearchConfig{URL: server.URL, Batch: batch})
+	assertion.NoError(t, err)
+
+	for _, message := range []string{"accepted", "invalid", "throttled"} {
+		_, _ = w.Write([]byte(`{"message":"` + message + `"}`))
+	}
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	docs := f.received()
+	if assert.Len(docs, 2) {
+		assert.Equal("accepted", docs[0].doc["message"])
+		assert.Equal("throttled", docs[1].doc["message"])
+	}
+	// the accepted and invalid documents are not sent again
+	assert.Equal(3, f.requests)
+	assert.Equal(1, f.seen["accepted"])
+	assert.Equal(1, f.seen["invalid"])
+
+	assert.Equal(1, lost)
+	if assert.Len(failures, 1) {
+		var esErr *ElasticsearchError
+		assert.True(errors.As(failures[0], &esErr))
+		assert.Equal(http.StatusBadRequest, esErr.Status)
+		assert.Equal("refused invalid", esErr.Reason)
+	}
+}
+
+func TestBulkFailuresMissingItems(t *testing.T) {
+	items := make([]batchItem, 3)
+	var bulk esBulkResponse
+	assertion.NoError(t, json.Unmarshal([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`), &bulk))
+	assert := assertion.New(t)
+
+	var partial *partialError
+	if assert.True(errors.As(bulkFailures(items, &bulk), &partial)) {
+		assert.Equal(2, partial.rejected)
+		assert.Empty(partial.retry)
+
+		var esErr *ElasticsearchError
+		assert.True(errors.As(partial, &esErr))
+		assert.Equal(2, esErr.Documents)
+		assert.Equal("apilogger: elasticsearch refused 2 documents: missing from the bulk response", esErr.Error())
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	at := time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	assert := assertion.New(t)
+
+	assert.Equal("apilogger-2024.03.02", indexName(defaultIndex, at))
+	assert.Equal("logs-2024-03", indexName("logs-{2006-01}", at))
+	assert.Equal("logs", indexName("logs", at))
+
+	_, err := NewElasticsearchWriter(ElasticsearchConfig{URL: "http://localhost:9200", Index: "logs-{2006"})
+	assert.Error(err)
+	_, err = NewElasticsearchWriter(ElasticsearchConfig{})
+	assert.Error(err)
+}
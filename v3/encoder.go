@@ -0,0 +1,92 @@
+package apilogger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Encoder renders entries. Implementations write one
+// complete record, line terminator included, to w.
+type Encoder interface {
+	Encode(w io.Writer, e *Entry) error
+}
+
+// textTimeFormat is the date and time layout used
+// after the level prefix of text lines.
+const textTimeFormat = "2006/01/02 15:04:05"
+
+// TextEncoder renders entries in the classic key="value"
+// format behind the level and date prefix. It is the
+// default encoder of a Logger. Quotes, backslashes and
+// control characters in values are escaped and keys are
+// stripped of them, so user data cannot forge fields or
+// lines. A field named like a standard key is written as
+// "fields.<name>". Entries logged in a span also have the
+// trace_id, span_id and trace_flags keys.
+type TextEncoder struct{}
+
+// textKeys are the standard keys of text lines.
+var textKeys = map[string]bool{
+	"uuid":     true,
+	"taskName": true,
+	"location": true,
+	"ms":       true,
+	"function": true,
+	"code":     true,
+	"type":     true,
+	"status":   true,
+	// written with a trace context only
+	"trace_id":    true,
+	"span_id":     true,
+	"trace_flags": true,
+}
+
+// Encode implements Encoder.
+func (TextEncoder) Encode(w io.Writer, e *Entry) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(e.Level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(e.Time.Format(textTimeFormat))
+	buf.WriteByte(' ')
+
+	buf.WriteString(`uuid=` + strconv.Quote(e.Context.UUID))
+	writeTextField(&buf, "taskName", e.Context.TaskName)
+	writeTextField(&buf, "location", e.Caller.Location())
+	writeTextField(&buf, "ms", strconv.FormatFloat(msElapsed(e), 'f', 6, 64))
+	// the double space before function is kept for
+	// the parsers that rely on the historical layout
+	buf.WriteString(`,  function=` + strconv.Quote(e.Caller.Function))
+	writeTextField(&buf, "code", e.LogCat.Code)
+	writeTextField(&buf, "type", e.LogCat.Type)
+	writeTextField(&buf, "status", e.Status.Type)
+	for _, f := range traceFields(e) {
+		writeTextField(&buf, f.key, f.value.(string))
+	}
+
+	if e.Fields == nil {
+		writeTextField(&buf, "message", e.Message)
+	}
+	for _, k := range sortedKeys(e.Fields) {
+		writeTextField(&buf, fieldKey(logfmtKey(k), textKeys), fmt.Sprint(e.Fields[k]))
+	}
+
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// msElapsed returns the elapsed time of the entry in milliseconds.
+func msElapsed(e *Entry) float64 {
+	return float64(e.Elapsed().Nanoseconds()) / 1e6
+}
+
+// writeTextField writes a key="value" pair after the previous one.
+func writeTextField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(", ")
+	buf.WriteString(logfmtKey(key))
+	buf.WriteByte('=')
+	buf.WriteString(strconv.Quote(value))
+}
@@ -0,0 +1,59 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// codeEncoder is a minimal custom Encoder.
+type codeEncoder struct{}
+
+func (codeEncoder) Encode(w io.Writer, e *Entry) error {
+	_, err := fmt.Fprintf(w, "%s|%s|%s|%s\n", e.Level, e.LogCat.Code, e.Caller.Function, e.Message)
+	return err
+}
+
+func TestCustomEncoder(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	logger := New(WithEncoder(codeEncoder{}))
+	logger.output = &out
+	logger.errOutput = &errOut
+
+	ctx := context.Background()
+	logger.Info(ctx, LogCatHealth, StatusCatPassed, "up")
+	logger.Warnf(ctx, LogCatHealth, StatusCatPending, "slow %dms", 250)
+	logger.Error(ctx, LogCatDatabase, StatusCatFailed, "down")
+	Info(ctx, LogCatDebug, StatusCatDebug, "global")
+
+	assert := assertion.New(t)
+	assert.Equal(
+		"INFO|HTH001|v3.TestCustomEncoder|up\n"+
+			"WARN|HTH001|v3.TestCustomEncoder|slow 250ms\n"+
+			"INFO|DBG001|v3.TestCustomEncoder|global\n",
+		out.String(),
+	)
+	assert.Equal("ERROR|DTA003|v3.TestCustomEncoder|down\n", errOut.String())
+}
+
+func TestTextEncoderPrefix(t *testing.T) {
+	assert := assertion.New(t)
+
+	for lvl, prefix := range map[Level]string{
+		LevelInfo:  "INFO ",
+		LevelWarn:  "WARN ",
+		LevelError: "ERROR ",
+		LevelFatal: "FATAL ",
+	} {
+		e := testEntry(LogCatDebug)
+		e.Level = lvl
+		output := textMessage(t, e)
+
+		assert.True(len(output) > len(prefix) && output[:len(prefix)] == prefix, output)
+	}
+}
@@ -0,0 +1,75 @@
+package apilogger
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Entry is a single log record as handed to an Encoder.
+type Entry struct {
+	Level Level
+
+	// Time is the moment the entry was logged
+	Time time.Time
+
+	// Context holds the task name, uuid and start time
+	// taken from the context passed to the log call
+	Context CtxKeys
+
+	// Trace is the span the entry was logged in,
+	// zero when the context carries none
+	Trace TraceContext
+
+	LogCat LogCat
+	Status StatusCat
+
+	// Message is the formatted message of the entry. It is
+	// empty for entries logged through the WF variants, whose
+	// content is carried by Fields instead.
+	Message string
+	Fields  Fields
+
+	// Caller is the code location of the log call
+	Caller Caller
+}
+
+// Caller identifies the code location of a log call.
+type Caller struct {
+	File     string
+	Line     int
+	Function string
+}
+
+// Location returns the caller as a file:line combination.
+func (c Caller) Location() string {
+	return fmt.Sprintf("%s:%d", c.File, c.Line)
+}
+
+// Elapsed returns the time passed between the start time
+// of the context and the entry, or zero if there is none.
+func (e *Entry) Elapsed() time.Duration {
+	if e.Context.StartTime.IsZero() {
+		return 0
+	}
+	return e.Time.Sub(e.Context.StartTime)
+}
+
+// newEntry builds the entry of a log call, without its message
+// or fields. It must be called at exactly depth-1 frames below
+// the public logging function so the caller is resolved correctly.
+func newEntry(ctx context.Context, level Level, logCat LogCat, status StatusCat) *Entry {
+	// Extract contextual values
+	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+	trace, _ := TraceContextFrom(ctx)
+
+	return &Entry{
+		Level:   level,
+		Time:    time.Now(),
+		Context: contextData,
+		Trace:   trace,
+		LogCat:  logCat,
+		Status:  status,
+		Caller:  caller(),
+	}
+}
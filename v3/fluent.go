@@ -0,0 +1,279 @@
+package apilogger
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FluentConfig configures a FluentWriter.
+type FluentConfig struct {
+	// Network is "tcp" (or its 4/6 variants) or "unix",
+	// "tcp" when empty.
+	Network string
+
+	// Addr of the forward input, e.g. localhost:24224
+	// or the path of a unix socket.
+	Addr string
+
+	// Service starts the tag of the entries, followed by their
+	// LogCat type, e.g. billing.smtp. "apilogger" when empty.
+	Service string
+
+	// RequireAck waits for the server to acknowledge every
+	// batch, sending it again when it does not: the entries are
+	// delivered at least once.
+	RequireAck bool
+
+	// Timeout bounds the connection, the write of a batch and
+	// the wait for its ack, 10s when zero.
+	Timeout time.Duration
+
+	// Batch sets the size of the batches and their retries.
+	Batch BatchConfig
+}
+
+// FluentWriter is a sink writer sending entries to Fluentd or Fluent
+// Bit with the forward protocol, in PackedForward mode: the entries of
+// a batch sharing a tag are sent as one message. Records hold the keys
+// of a JSONEncoder, with the fields as native MessagePack values. The
+// connection is reestablished when a send fails, and failed batches
+// are retried like those of an HTTPWriter.
+type FluentWriter struct {
+	cfg     FluentConfig
+	batcher *batcher
+
+	// conn is only used by the sending goroutine,
+	// mu guards it against Close
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// fluentEvent is an entry buffered by a FluentWriter,
+// the MessagePack [time, record] array of the entry.
+type fluentEvent struct {
+	tag   string
+	event []byte
+}
+
+// NewFluentWriter returns a FluentWriter for the config. It does
+// not connect until the first batch is sent.
+func NewFluentWriter(cfg FluentConfig) (*FluentWriter, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("apilogger: fluent sink without an address")
+	}
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.Service == "" {
+		cfg.Service = "apilogger"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	w := &FluentWriter{cfg: cfg}
+	w.batcher = newBatcher(cfg.Batch, w.send)
+	return w, nil
+}
+
+// WriteEntry implements EntryWriter.
+func (w *FluentWriter) WriteEntry(e *Entry, p []byte) error {
+	tag := w.cfg.Service
+	if e.LogCat.Type != "" {
+		tag += "." + e.LogCat.Type
+	}
+	return w.add(tag, e.Time, fluentRecord(e))
+}
+
+// Write implements io.Writer, sending p as the
+// message of a record tagged with the service.
+func (w *FluentWriter) Write(p []byte) (int, error) {
+	record := []jsonField{{"message", strings.TrimSuffix(string(p), "\n")}}
+	if err := w.add(w.cfg.Service, time.Now(), record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *FluentWriter) add(tag string, t time.Time, record []jsonField) error {
+	event := msgpackArray(nil, 2)
+	event = msgpackEventTime(event, t)
+	event = msgpackMap(event, len(record))
+	for _, f := range record {
+		event = msgpackString(event, f.key)
+		event = msgpackValue(event, f.value)
+	}
+	return w.batcher.add(fluentEvent{tag, event}, len(event))
+}
+
+// Flush sends the current batch and waits until
+// every batch written so far is sent or dropped.
+func (w *FluentWriter) Flush() error {
+	w.batcher.flush()
+	return nil
+}
+
+// Close sends the current batch, stops the writer
+// and closes the connection.
+func (w *FluentWriter) Close() error {
+	err := w.batcher.close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// fluentRecord returns the record of the entry. Its time is
+// sent as the time of the event rather than as a key.
+func fluentRecord(e *Entry) []jsonField {
+	return appendFields(entryFields(e, nil, msElapsed(e)), e, nil)
+}
+
+// send sends the batch once, one PackedForward message per tag.
+// The messages sent before a failure are not sent again.
+func (w *FluentWriter) send(items []batchItem) error {
+	// tags keep the order of their first entry
+	var tags []string
+	byTag := make(map[string][]batchItem)
+	for _, item := range items {
+		tag := item.value.(fluentEvent).tag
+		if _, ok := byTag[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		byTag[tag] = append(byTag[tag], item)
+	}
+
+	for i, tag := range tags {
+		if err := w.sendMessage(tag, byTag[tag]); err != nil {
+			w.disconnect()
+			if i == 0 {
+				return err
+			}
+
+			var retry []batchItem
+			for _, tag := range tags[i:] {
+				retry = append(retry, byTag[tag]...)
+			}
+			return &partialError{err: err, retry: retry}
+		}
+	}
+	return nil
+}
+
+// sendMessage sends the events of a tag as a
+// PackedForward message and waits for its ack.
+func (w *FluentWriter) sendMessage(tag string, items []batchItem) error {
+	var entries []byte
+	for _, item := range items {
+		entries = append(entries, item.value.(fluentEvent).event...)
+	}
+
+	var chunk string
+	optionSize := 1
+	if w.cfg.RequireAck {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		optionSize++
+	}
+
+	msg := msgpackArray(nil, 3)
+	msg = msgpackString(msg, tag)
+	msg = msgpackBin(msg, entries)
+	msg = msgpackMap(msg, optionSize)
+	msg = msgpackString(msg, "size")
+	msg = msgpackUint(msg, uint64(len(items)))
+	if chunk != "" {
+		msg = msgpackString(msg, "chunk")
+		msg = msgpackString(msg, chunk)
+	}
+
+	conn, r, err := w.connect()
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(w.cfg.Timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	ack, err := readFluentAck(r)
+	if err != nil {
+		return fmt.Errorf("apilogger: no fluent ack: %w", err)
+	}
+	if ack != chunk {
+		return fmt.Errorf("apilogger: fluent ack %q for chunk %q", ack, chunk)
+	}
+	return nil
+}
+
+// connect returns the connection, establishing it when needed.
+func (w *FluentWriter) connect() (net.Conn, *bufio.Reader, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.cfg.Network, w.cfg.Addr, w.cfg.Timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		w.conn = conn
+		w.r = bufio.NewReader(conn)
+	}
+	return w.conn, w.r, nil
+}
+
+// disconnect closes the connection after a failure,
+// so the next send reconnects.
+func (w *FluentWriter) disconnect() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// readFluentAck reads the {"ack": chunk} response to a message.
+func readFluentAck(r *bufio.Reader) (string, error) {
+	n, err := readMsgpackMapHeader(r)
+	if err != nil {
+		return "", err
+	}
+
+	var ack string
+	for i := 0; i < n; i++ {
+		key, err := readMsgpackString(r)
+		if err != nil {
+			return "", err
+		}
+		value, err := readMsgpackString(r)
+		if err != nil {
+			return "", err
+		}
+		if key == "ack" {
+			ack = value
+		}
+	}
+	return ack, nil
+}
@@ -0,0 +1,239 @@
+package apilogger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// fluentRecv is a record received by forwardServer.
+type fluentRecv struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// forwardServer is an in-process Fluent forward input decoding
+// PackedForward messages and acknowledging their chunks.
+type forwardServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	records  []fluentRecv
+	messages int
+	// drop closes the connection instead of acknowledging
+	// the given message, counted from 1
+	drop func(message int) bool
+}
+
+func newForwardServer(t *testing.T, network string) *forwardServer {
+	addr := "127.0.0.1:0"
+	if network == "unix" {
+		addr = filepath.Join(t.TempDir(), "fluent.sock")
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &forwardServer{ln: ln}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *forwardServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *forwardServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		v, err := decodeMsgpack(r)
+		if err != nil {
+			return
+		}
+		msg, ok := v.([]interface{})
+		if !ok || len(msg) != 3 {
+			return
+		}
+		tag, _ := msg[0].(string)
+		entries, _ := msg[1].([]byte)
+		option, _ := msg[2].(map[string]interface{})
+
+		var records []fluentRecv
+		er := bufio.NewReader(bytes.NewReader(entries))
+		for {
+			v, err := decodeMsgpack(er)
+			if err != nil {
+				break
+			}
+			event := v.([]interface{})
+			records = append(records, fluentRecv{
+				tag, event[0].(time.Time), event[1].(map[string]interface{}),
+			})
+		}
+		if option["size"] != int64(len(records)) {
+			return
+		}
+
+		s.mu.Lock()
+		s.messages++
+		dropped := s.drop != nil && s.drop(s.messages)
+		if !dropped {
+			s.records = append(s.records, records...)
+		}
+		s.mu.Unlock()
+		if dropped {
+			return
+		}
+
+		if chunk, ok := option["chunk"].(string); ok {
+			ack := msgpackMap(nil, 1)
+			ack = msgpackString(ack, "ack")
+			ack = msgpackString(ack, chunk)
+			if _, err := conn.Write(ack); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *forwardServer) received() []fluentRecv {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fluentRecv(nil), s.records...)
+}
+
+func TestFluentWriter(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		s := newForwardServer(t, network)
+		w, err := NewFluentWriter(FluentConfig{
+			Network:    network,
+			Addr:       s.ln.Addr().String(),
+			Service:    "billing",
+			RequireAck: true,
+			Batch:      fastRetries,
+		})
+		assertion.NoError(t, err)
+
+		logger := New(WithSink(Sink{Name: "fluent", Writer: w}))
+		ctx := context.WithValue(context.Background(), ContextData, CtxKeys{UUID: "12345zw"})
+		logger.Info(ctx, LogCatCSV, StatusCatPassed, "imported")
+		logger.InfoWF(ctx, LogCatSMTP, StatusCatFailed, &Fields{"attempts": 3, "level": "custom"})
+		logger.Info(ctx, LogCatCSV, StatusCatPassed, "again")
+		_, err = w.Write([]byte("plain\n"))
+		assertion.NoError(t, err)
+		assertion.NoError(t, w.Close())
+
+		assert := assertion.New(t)
+		records := s.received()
+		if !assert.Len(records, 4, network) {
+			continue
+		}
+
+		// PackedForward groups the entries of a tag
+		assert.Equal(3, s.messages, network)
+		assert.Equal("billing.csv", records[0].tag)
+		assert.Equal("imported", records[0].record["message"])
+		assert.Equal("again", records[1].record["message"])
+		assert.Equal("billing.smtp", records[2].tag)
+		assert.Equal("billing", records[3].tag)
+		assert.Equal("plain", records[3].record["message"])
+
+		assert.Equal("INFO", records[0].record["level"])
+		assert.Equal("12345zw", records[0].record["uuid"])
+		assert.Equal(LogCatCSV.Code, records[0].record["code"])
+		assert.Equal("Passed", records[0].record["status"])
+		assert.Equal(int64(3), records[2].record["attempts"])
+		assert.Equal("custom", records[2].record["fields.level"])
+		assert.WithinDuration(time.Now(), records[0].time, time.Minute)
+	}
+}
+
+// recordKeys returns the keys of the record, in order.
+func recordKeys(record []jsonField) []string {
+	keys := make([]string, 0, len(record))
+	for _, f := range record {
+		keys = append(keys, f.key)
+	}
+	return keys
+}
+
+func TestFluentRecord(t *testing.T) {
+	assert := assertion.New(t)
+	base := []string{"level", "uuid", "taskName", "location", "ms", "function", "code", "type", "status"}
+
+	// the time is that of the event, not a key
+	e := testEntry(LogCatDebug)
+	assert.Equal(append(base, "message"), recordKeys(fluentRecord(e)))
+
+	e.Fields = Fields{"b": 2, "a": 1, "code": "shadowed"}
+	assert.Equal(append(base, "a", "b", "fields.code"), recordKeys(fluentRecord(e)))
+
+	e.Fields = nil
+	e.Trace, _ = ParseTraceparent(testTraceparent)
+	assert.Equal(append(base, "trace_id", "span_id", "trace_flags", "message"), recordKeys(fluentRecord(e)))
+}
+
+func TestFluentWriterReconnects(t *testing.T) {
+	s := newForwardServer(t, "tcp")
+	s.drop = func(message int) bool { return message == 1 }
+
+	w, err := NewFluentWriter(FluentConfig{
+		Addr:       s.ln.Addr().String(),
+		RequireAck: true,
+		Batch:      fastRetries,
+	})
+	assertion.NoError(t, err)
+
+	_, _ = w.Write([]byte("first\n"))
+	assertion.NoError(t, w.Flush())
+	_, _ = w.Write([]byte("second\n"))
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	records := s.received()
+	if assert.Len(records, 2) {
+		// the unacknowledged batch was sent again
+		assert.Equal("first", records[0].record["message"])
+		assert.Equal("second", records[1].record["message"])
+	}
+	assert.Equal(3, s.messages)
+}
+
+func TestFluentWriterUnreachable(t *testing.T) {
+	var lost int
+	batch := fastRetries
+	batch.MaxRetries = 1
+	batch.OnError = func(err error, entries int) { lost += entries }
+
+	w, err := NewFluentWriter(FluentConfig{
+		Network: "unix",
+		Addr:    filepath.Join(t.TempDir(), "missing.sock"),
+		Batch:   batch,
+	})
+	assertion.NoError(t, err)
+
+	_, _ = w.Write([]byte("lost\n"))
+	assertion.NoError(t, w.Close())
+	assertion.Equal(t, 1, lost)
+
+	_, err = NewFluentWriter(FluentConfig{})
+	assertion.Error(t, err)
+}
@@ -0,0 +1,344 @@
+package apilogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GELFCompression is the compression of GELF messages sent over UDP.
+type GELFCompression int
+
+// GELF compressions.
+const (
+	GELFGzip GELFCompression = iota
+	GELFZlib
+	GELFNone
+)
+
+// GELF chunking, messages larger than a chunk are sent in up
+// to gelfMaxChunks chunks, each starting with a 12 bytes header.
+const (
+	gelfChunkSize   = 1420
+	gelfMaxChunks   = 128
+	gelfChunkHeader = 12
+)
+
+// GELFConfig configures a GELFWriter.
+type GELFConfig struct {
+	// Network is "udp" or "tcp" (or their 4/6 variants),
+	// "udp" when empty.
+	Network string
+
+	// Addr of the GELF input, e.g. graylog:12201.
+	Addr string
+
+	// Host of the messages, the name of the host when empty.
+	Host string
+
+	// Compression of the UDP messages, gzip by default. TCP
+	// messages are never compressed.
+	Compression GELFCompression
+
+	// ChunkSize is the size of the UDP datagrams, larger messages
+	// are chunked. 1420 when zero, which fits most networks.
+	ChunkSize int
+}
+
+// GELFWriter is a sink writer sending entries to Graylog as GELF 1.1
+// messages, over UDP, compressed and chunked when needed, or over TCP,
+// null delimited. The message is the short_message, the level the
+// syslog severity and the code, type, status, uuid, taskName, function,
+// trace_id, span_id and trace_flags, and fields are sent as additional
+// fields.
+type GELFWriter struct {
+	cfg  GELFConfig
+	host string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+	closed bool
+}
+
+// DialGELF connects to the GELF input of the config.
+func DialGELF(cfg GELFConfig) (*GELFWriter, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("apilogger: GELF sink without an address")
+	}
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+	if cfg.ChunkSize <= gelfChunkHeader {
+		cfg.ChunkSize = gelfChunkSize
+	}
+
+	w := &GELFWriter{cfg: cfg, host: cfg.Host}
+	if w.host == "" {
+		w.host, _ = os.Hostname()
+	}
+
+	switch cfg.Network {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		w.stream = true
+	default:
+		return nil, fmt.Errorf("apilogger: unsupported GELF network %q", cfg.Network)
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect (re)establishes the connection. It must be called with mu held.
+func (w *GELFWriter) connect() error {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	conn, err := net.Dial(w.cfg.Network, w.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// WriteEntry implements EntryWriter.
+func (w *GELFWriter) WriteEntry(e *Entry, p []byte) error {
+	msg := []jsonField{
+		{"version", "1.1"},
+		{"host", w.host},
+		{"timestamp", unixSeconds(e.Time)},
+		{"level", syslogSeverity(e.Level)},
+	}
+	msg = append(msg, gelfMessage(journalMessage(e), e.LogCat.Code)...)
+	msg = append(msg,
+		jsonField{"_code", e.LogCat.Code},
+		jsonField{"_type", e.LogCat.Type},
+		jsonField{"_status", e.Status.Type},
+		jsonField{"_uuid", e.Context.UUID},
+		jsonField{"_taskName", e.Context.TaskName},
+		jsonField{"_function", e.Caller.Function},
+	)
+	for _, f := range traceFields(e) {
+		msg = append(msg, jsonField{"_" + f.key, f.value})
+	}
+
+	reserved := make(map[string]bool, len(msg)+1)
+	for _, f := range msg {
+		reserved[strings.TrimPrefix(f.key, "_")] = true
+	}
+	// _id is reserved by Graylog
+	reserved["id"] = true
+
+	for _, k := range sortedKeys(e.Fields) {
+		msg = append(msg, jsonField{"_" + fieldKey(gelfFieldName(k), reserved), gelfValue(e.Fields[k])})
+	}
+
+	return w.send(msg)
+}
+
+// Write implements io.Writer, sending p as the
+// message of an entry of informational level.
+func (w *GELFWriter) Write(p []byte) (int, error) {
+	msg := []jsonField{
+		{"version", "1.1"},
+		{"host", w.host},
+		{"timestamp", unixSeconds(time.Now())},
+		{"level", syslogSeverity(LevelInfo)},
+	}
+	msg = append(msg, gelfMessage(strings.TrimSuffix(string(p), "\n"), "")...)
+
+	if err := w.send(msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send sends the message, reconnecting once on failure.
+func (w *GELFWriter) send(msg []jsonField) error {
+	var fields []jsonField
+	for _, f := range msg {
+		if s, ok := f.value.(string); ok && s == "" && f.key != "short_message" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	var buf bytes.Buffer
+	writeJSONLine(&buf, fields)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.conn == nil {
+		// the last reconnection failed
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+
+	if w.stream {
+		buf.WriteByte(0)
+		_, err := w.conn.Write(buf.Bytes())
+		if err != nil {
+			// the server may have restarted, retry once
+			if err = w.connect(); err == nil {
+				_, err = w.conn.Write(buf.Bytes())
+			}
+		}
+		return err
+	}
+
+	payload, err := w.compress(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return w.sendDatagrams(payload)
+}
+
+// compress compresses the payload of a UDP message.
+func (w *GELFWriter) compress(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch w.cfg.Compression {
+	case GELFNone:
+		return p, nil
+	case GELFZlib:
+		zw = zlib.NewWriter(&buf)
+	default:
+		zw = gzip.NewWriter(&buf)
+	}
+
+	if _, err := zw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendDatagrams sends the payload in one datagram,
+// or in chunks when it is too large.
+func (w *GELFWriter) sendDatagrams(payload []byte) error {
+	if len(payload) <= w.cfg.ChunkSize {
+		_, err := w.conn.Write(payload)
+		return err
+	}
+
+	size := w.cfg.ChunkSize - gelfChunkHeader
+	count := (len(payload) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("apilogger: GELF message of %d bytes is too large", len(payload))
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 0, w.cfg.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*size:end]...)
+		if _, err := w.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (w *GELFWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// gelfMessage returns the short_message of the message, its first
+// line, and the full_message when it spans several lines. Graylog
+// drops messages without a short_message, so fallback, or "-", is
+// used when the first line is blank.
+func gelfMessage(message, fallback string) []jsonField {
+	short := message
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		short = message[:i]
+	}
+	if strings.TrimSpace(short) == "" {
+		short = fallback
+		if short == "" {
+			short = "-"
+		}
+	}
+
+	if short == message {
+		return []jsonField{{"short_message", short}}
+	}
+	return []jsonField{{"short_message", short}, {"full_message", message}}
+}
+
+// gelfFieldName replaces the characters not allowed in the
+// name of an additional field with an underscore.
+func gelfFieldName(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+}
+
+// gelfValue returns v as an additional field value, which
+// is either a number or a string.
+func gelfValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
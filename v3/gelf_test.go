@@ -0,0 +1,242 @@
+package apilogger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// readGELFDatagrams reads a GELF message from conn,
+// reassembling its chunks and decompressing it.
+func readGELFDatagrams(t *testing.T, conn net.PacketConn) (map[string]interface{}, int) {
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload []byte
+	var chunks [][]byte
+	received := 0
+	for {
+		buf := make([]byte, 65536)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = buf[:n]
+		received++
+
+		if n < 2 || buf[0] != 0x1e || buf[1] != 0x0f {
+			payload = buf
+			break
+		}
+
+		seq, count := int(buf[10]), int(buf[11])
+		if chunks == nil {
+			chunks = make([][]byte, count)
+		}
+		chunks[seq] = buf[12:]
+		if received == count {
+			payload = bytes.Join(chunks, nil)
+			break
+		}
+	}
+
+	var r io.Reader = bytes.NewReader(payload)
+	switch {
+	case payload[0] == 0x1f && payload[1] == 0x8b:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case payload[0] == 0x78:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("invalid GELF message %q: %v", data, err)
+	}
+	return msg, received
+}
+
+func TestGELFWriterUDP(t *testing.T) {
+	compressions := []GELFCompression{GELFGzip, GELFZlib, GELFNone}
+	for _, compression := range compressions {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := DialGELF(GELFConfig{Addr: conn.LocalAddr().String(), Host: "web-1", Compression: compression})
+		assertion.NoError(t, err)
+
+		logger := New(WithSink(Sink{Name: "graylog", Writer: w}))
+		ctx := context.WithValue(context.Background(), ContextData, CtxKeys{UUID: "12345zw", TaskName: "Import"})
+		logger.Error(ctx, LogCatCSV, StatusCatFailed, "import failed\nline 2")
+		msg, _ := readGELFDatagrams(t, conn)
+
+		assert := assertion.New(t)
+		assert.Equal("1.1", msg["version"])
+		assert.Equal("web-1", msg["host"])
+		assert.Equal(float64(3), msg["level"])
+		assert.Equal("import failed", msg["short_message"])
+		assert.Equal("import failed\nline 2", msg["full_message"])
+		assert.Equal(LogCatCSV.Code, msg["_code"])
+		assert.Equal(LogCatCSV.Type, msg["_type"])
+		assert.Equal("Failed", msg["_status"])
+		assert.Equal("12345zw", msg["_uuid"])
+		assert.Equal("Import", msg["_taskName"])
+		assert.Contains(msg["_function"], "TestGELFWriterUDP")
+		assert.InDelta(float64(time.Now().Unix()), msg["timestamp"], 60)
+
+		logger.InfoWF(ctx, LogCatCSV, StatusCatPassed, &Fields{"rows": 12, "id": "x", "code": "y", "file name": "a.csv"})
+		msg, _ = readGELFDatagrams(t, conn)
+		assert.Equal(float64(6), msg["level"])
+		assert.Equal("code=y file_name=a.csv id=x rows=12", msg["short_message"])
+		assert.Equal(float64(12), msg["_rows"])
+		assert.Equal("x", msg["_fields.id"])
+		assert.Equal("y", msg["_fields.code"])
+		assert.Equal(LogCatCSV.Code, msg["_code"])
+		assert.Equal("a.csv", msg["_file_name"])
+
+		// a key sanitized into a standard one cannot forge it
+		traced, _ := WithTraceparent(ctx, testTraceparent)
+		logger.InfoWF(traced, LogCatCSV, StatusCatPassed, &Fields{"trace id": "forged"})
+		msg, _ = readGELFDatagrams(t, conn)
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", msg["_trace_id"])
+		assert.Equal("forged", msg["_fields.trace_id"])
+
+		assert.NoError(w.Close())
+		conn.Close()
+	}
+}
+
+func TestGELFWriterEmptyMessage(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := DialGELF(GELFConfig{Addr: conn.LocalAddr().String(), Compression: GELFNone})
+	assertion.NoError(t, err)
+	defer w.Close()
+
+	logger := New(WithSink(Sink{Name: "graylog", Writer: w}))
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	// Graylog drops the messages without a short_message
+	logger.Info(ctx, LogCatCSV, StatusCatPassed, "")
+	msg, _ := readGELFDatagrams(t, conn)
+	assert.Equal(LogCatCSV.Code, msg["short_message"])
+	assert.NotContains(msg, "full_message")
+
+	logger.InfoWF(ctx, LogCatCSV, StatusCatPassed, &Fields{})
+	msg, _ = readGELFDatagrams(t, conn)
+	assert.Equal(LogCatCSV.Code, msg["short_message"])
+
+	logger.Info(ctx, LogCatCSV, StatusCatPassed, "\nsecond line")
+	msg, _ = readGELFDatagrams(t, conn)
+	assert.Equal(LogCatCSV.Code, msg["short_message"])
+	assert.Equal("\nsecond line", msg["full_message"])
+
+	_, err = w.Write([]byte("\n"))
+	assert.NoError(err)
+	msg, _ = readGELFDatagrams(t, conn)
+	assert.Equal("-", msg["short_message"])
+}
+
+func TestGELFWriterChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := DialGELF(GELFConfig{Addr: conn.LocalAddr().String(), Compression: GELFNone, ChunkSize: 512})
+	assertion.NoError(t, err)
+	defer w.Close()
+
+	long := strings.Repeat("0123456789", 300)
+	_, err = w.Write([]byte(long + "\n"))
+	assertion.NoError(t, err)
+
+	msg, datagrams := readGELFDatagrams(t, conn)
+	assertion.Equal(t, long, msg["short_message"])
+	assertion.True(t, datagrams > 1)
+
+	// more than 128 chunks cannot be sent
+	_, err = w.Write([]byte(strings.Repeat("x", 128*500)))
+	assertion.Error(t, err)
+}
+
+func TestGELFWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	messages := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			messages <- strings.TrimSuffix(msg, "\x00")
+		}
+	}()
+
+	w, err := DialGELF(GELFConfig{Network: "tcp", Addr: ln.Addr().String()})
+	assertion.NoError(t, err)
+
+	_, err = w.Write([]byte("first\n"))
+	assertion.NoError(t, err)
+	_, err = w.Write([]byte("second\n"))
+	assertion.NoError(t, err)
+	assertion.NoError(t, w.Close())
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case msg := <-messages:
+			var m map[string]interface{}
+			assertion.NoError(t, json.Unmarshal([]byte(msg), &m))
+			assertion.Equal(t, want, m["short_message"])
+		case <-time.After(2 * time.Second):
+			t.Fatal("no GELF message received")
+		}
+	}
+
+	_, err = w.Write([]byte("closed\n"))
+	assertion.Error(t, err)
+	_, err = DialGELF(GELFConfig{Network: "unix", Addr: "/dev/null"})
+	assertion.Error(t, err)
+}
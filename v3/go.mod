@@ -3,6 +3,7 @@ module github.com/sanservices/apilogger/v3
 go 1.15
 
 require (
+	github.com/golang/snappy v0.0.4
 	github.com/google/uuid v1.6.0
 	github.com/stretchr/testify v1.7.0
 )
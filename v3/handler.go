@@ -0,0 +1,179 @@
+package apilogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LevelHandler is an http.Handler reporting and changing the levels
+// of a Logger at runtime, e.g. to raise the verbosity of a live
+// service without redeploying it.
+//
+// GET responds with the current levels:
+//
+//	{"level":"INFO","categories":{"KFK007":"WARN"}}
+//
+// PUT changes them. Every key is optional, categories accept the
+// patterns of a Policy and "OFF", a category set to null follows
+// the level of the Logger again, and revertAfter restores
+// the levels that were set before the change once it elapses:
+//
+//	{"level":"DEBUG","categories":{"HTH001":"ERROR","KFK007":null},"revertAfter":"15m"}
+//
+// A change without revertAfter made while a revert is pending
+// is reverted along with it.
+type LevelHandler struct {
+	logger *Logger
+
+	// RevertAfter is used as revertAfter of PUT requests that do not
+	// set one, so a forgotten DEBUG level resets itself. Zero keeps
+	// changes until the next PUT.
+	RevertAfter time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	revertAt time.Time
+	// baseline is the state restored when the timer fires. It is
+	// kept across successive changes so the state from before the
+	// first of them is restored.
+	baseline *levelState
+}
+
+// levelState is the representation of the levels of a Logger.
+type levelState struct {
+	Level      Level            `json:"level"`
+	Categories map[string]Level `json:"categories"`
+	RevertAt   *time.Time       `json:"revertAt,omitempty"`
+}
+
+// levelChange is the body of a PUT request.
+type levelChange struct {
+	Level       *Level            `json:"level"`
+	Categories  map[string]*Level `json:"categories"`
+	RevertAfter *string           `json:"revertAfter"`
+}
+
+// NewLevelHandler returns a LevelHandler for the given Logger.
+func NewLevelHandler(l *Logger) *LevelHandler {
+	return &LevelHandler{logger: l}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writeState(w, http.StatusOK)
+
+	case http.MethodPut:
+		var change levelChange
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		revertAfter := h.RevertAfter
+		if change.RevertAfter != nil {
+			d, err := time.ParseDuration(*change.RevertAfter)
+			if err != nil || d < 0 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid revertAfter %q", *change.RevertAfter))
+				return
+			}
+			revertAfter = d
+		}
+
+		h.apply(change, revertAfter)
+		h.writeState(w, http.StatusOK)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// apply changes the levels of the Logger and schedules
+// their revert when revertAfter is not zero.
+func (h *LevelHandler) apply(change levelChange, revertAfter time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a change that does not set revertAfter itself is
+	// reverted along with the pending one, if any
+	pending := h.timer != nil && change.RevertAfter == nil && revertAfter == 0
+	if !pending {
+		if h.timer != nil {
+			h.timer.Stop()
+			h.timer = nil
+		}
+		if revertAfter == 0 {
+			// the change is meant to stay
+			h.baseline = nil
+		} else if h.baseline == nil {
+			h.baseline = h.snapshot()
+		}
+	}
+
+	if change.Level != nil {
+		h.logger.SetLevel(*change.Level)
+	}
+	for code, level := range change.Categories {
+		if level == nil {
+			h.logger.ClearCategoryLevel(code)
+			continue
+		}
+		h.logger.SetCategoryLevel(code, *level)
+	}
+
+	if pending || revertAfter == 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(revertAfter, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		// a later change replaced this timer
+		if h.timer != timer {
+			return
+		}
+		h.logger.SetLevel(h.baseline.Level)
+		h.logger.SetPolicy(h.baseline.Categories)
+		h.timer = nil
+		h.baseline = nil
+	})
+	h.timer = timer
+	h.revertAt = time.Now().Add(revertAfter)
+}
+
+// snapshot returns the current levels of the Logger.
+func (h *LevelHandler) snapshot() *levelState {
+	return &levelState{
+		Level:      h.logger.Level(),
+		Categories: h.logger.CategoryLevels(),
+	}
+}
+
+// writeState responds with the current levels of the Logger.
+func (h *LevelHandler) writeState(w http.ResponseWriter, status int) {
+	h.mu.Lock()
+	state := h.snapshot()
+	if h.timer != nil {
+		revertAt := h.revertAt
+		state.RevertAt = &revertAt
+	}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(state)
+}
+
+// writeJSONError responds with the error as a JSON object.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
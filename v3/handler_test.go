@@ -0,0 +1,157 @@
+package apilogger
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// doLevelRequest sends a request to the handler and decodes the response.
+func doLevelRequest(t *testing.T, h http.Handler, method, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, "/log/level", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, decoded
+}
+
+func TestLevelHandlerGetAndPut(t *testing.T) {
+	logger := New()
+	logger.output = ioutil.Discard
+	logger.SetCategoryLevel(LogCatKafkaConsume.Code, LevelWarn)
+	h := NewLevelHandler(logger)
+	assert := assertion.New(t)
+
+	status, state := doLevelRequest(t, h, http.MethodGet, "")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal("INFO", state["level"])
+	assert.Equal(map[string]interface{}{"KFK007": "WARN"}, state["categories"])
+	assert.NotContains(state, "revertAt")
+
+	status, state = doLevelRequest(t, h, http.MethodPut,
+		`{"level":"debug","categories":{"HTH001":"ERROR","KFK007":null}}`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal("DEBUG", state["level"])
+	assert.Equal(map[string]interface{}{"HTH001": "ERROR"}, state["categories"])
+
+	assert.Equal(LevelDebug, logger.Level())
+	assert.Equal(map[string]Level{"HTH001": LevelError}, logger.CategoryLevels())
+}
+
+func TestLevelHandlerErrors(t *testing.T) {
+	h := NewLevelHandler(New())
+	assert := assertion.New(t)
+
+	status, body := doLevelRequest(t, h, http.MethodPut, `{"level":"LOUD"}`)
+	assert.Equal(http.StatusBadRequest, status)
+	assert.Contains(body["error"], "LOUD")
+
+	status, _ = doLevelRequest(t, h, http.MethodPut, `{"revertAfter":"soon"}`)
+	assert.Equal(http.StatusBadRequest, status)
+
+	status, _ = doLevelRequest(t, h, http.MethodPost, `{}`)
+	assert.Equal(http.StatusMethodNotAllowed, status)
+}
+
+func TestLevelHandlerRevert(t *testing.T) {
+	logger := New()
+	logger.SetCategoryLevel(LogCatHealth.Code, LevelError)
+	h := NewLevelHandler(logger)
+	h.RevertAfter = 50 * time.Millisecond
+	assert := assertion.New(t)
+
+	_, state := doLevelRequest(t, h, http.MethodPut, `{"level":"DEBUG","categories":{"HTH001":null}}`)
+	assert.Contains(state, "revertAt")
+
+	// a second change before the revert keeps the original baseline
+	_, _ = doLevelRequest(t, h, http.MethodPut, `{"level":"TRACE"}`)
+	assert.Equal(LevelTrace, logger.Level())
+
+	assert.Eventually(func() bool {
+		return logger.Level() == LevelInfo
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(map[string]Level{"HTH001": LevelError}, logger.CategoryLevels())
+
+	_, state = doLevelRequest(t, h, http.MethodGet, "")
+	assert.NotContains(state, "revertAt")
+}
+
+func TestLevelHandlerNoRevert(t *testing.T) {
+	logger := New()
+	h := NewLevelHandler(logger)
+	h.RevertAfter = 20 * time.Millisecond
+
+	_, state := doLevelRequest(t, h, http.MethodPut, `{"level":"WARN","revertAfter":"0s"}`)
+	assertion.NotContains(t, state, "revertAt")
+
+	time.Sleep(60 * time.Millisecond)
+	assertion.Equal(t, LevelWarn, logger.Level())
+}
+
+func TestLevelHandlerKeepsPendingRevert(t *testing.T) {
+	logger := New()
+	h := NewLevelHandler(logger)
+	assert := assertion.New(t)
+
+	_, _ = doLevelRequest(t, h, http.MethodPut, `{"level":"DEBUG","revertAfter":"50ms"}`)
+
+	// a change without revertAfter does not make the level permanent
+	_, state := doLevelRequest(t, h, http.MethodPut, `{"categories":{"HTH001":"ERROR"}}`)
+	assert.Contains(state, "revertAt")
+	assert.Equal(LevelDebug, logger.Level())
+
+	assert.Eventually(func() bool {
+		return logger.Level() == LevelInfo
+	}, time.Second, 5*time.Millisecond)
+	assert.Empty(logger.CategoryLevels())
+}
+
+func TestLevelHandlerConcurrentLogging(t *testing.T) {
+	logger := New()
+	logger.output = ioutil.Discard
+	logger.errOutput = ioutil.Discard
+	h := NewLevelHandler(logger)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logger.Debug(ctx, LogCatKafkaConsume, StatusCatDebug, "consumed")
+					logger.Info(ctx, LogCatHealth, StatusCatPassed, "healthy")
+				}
+			}
+		}()
+	}
+
+	for _, body := range []string{
+		`{"level":"DEBUG"}`,
+		`{"categories":{"KFK007":"TRACE","HTH001":"ERROR"}}`,
+		`{"level":"INFO","categories":{"KFK007":null}}`,
+	} {
+		status, _ := doLevelRequest(t, h, http.MethodPut, body)
+		assertion.Equal(t, http.StatusOK, status)
+	}
+
+	close(stop)
+	wg.Wait()
+}
@@ -1,95 +1,57 @@
 package apilogger
 
 import (
-	"fmt"
 	"os"
-	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 )
 
-// location returns the location of the log call
-// as a file/line combination, mostly advantageous
-// for dev purposes as this would act as a hyperlink
-// to the line of code in question in most IDEs/editors
-func location() string {
-	workDir, _ := os.Getwd()
-	_, fn, line, _ := runtime.Caller(depth)
-	fn = strings.TrimPrefix(fn, workDir+"/")
-	return fmt.Sprintf("%s:%d", fn, line)
-}
-
-// returns the name of caller function.
-func funcName() string {
-	// Skip 2 levels to get the caller.
-	pc, _, _, ok := runtime.Caller(depth)
+// caller returns the location of the log call as a
+// file/line combination, mostly advantageous for dev
+// purposes as this would act as a hyperlink to the line
+// of code in question in most IDEs/editors, together
+// with the name of the calling function.
+func caller() Caller {
+	pc, fn, line, ok := runtime.Caller(depth)
 	if !ok {
-		fmt.Println("MSG: NO CALLER")
-		return ""
+		return Caller{}
 	}
 
-	// get the function caller.
-	caller := runtime.FuncForPC(pc)
-	if caller == nil {
-		fmt.Println("MSG CALLER WAS NIL")
+	workDir, _ := os.Getwd()
+	return Caller{
+		File:     strings.TrimPrefix(fn, workDir+"/"),
+		Line:     line,
+		Function: funcName(pc),
 	}
-
-	// remove extra file path characters.
-	r := regexp.MustCompile(`[^/]+$`)
-	return fmt.Sprintf("%s", r.FindString(caller.Name()))
 }
 
-// builds standard information.
-func baseMessage(logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat) string {
-	var elapsed time.Duration
-	// If time is nonzero
-	if !startTime.IsZero() {
-		elapsed = time.Since(startTime)
+// returns the name of the function at pc.
+func funcName(pc uintptr) string {
+	caller := runtime.FuncForPC(pc)
+	if caller == nil {
+		return ""
 	}
-	msElapsed := float64(elapsed.Nanoseconds()) / float64(time.Millisecond)
 
-	return fmt.Sprintf(
-		`uuid="%s", taskName="%s", location="%s", ms="%f",  function="%s", code="%s", type="%s", status="%s"`,
-		uuId,
-		taskName,
-		location(),
-		msElapsed,
-		funcName(),
-		logCat.Code,
-		logCat.Type,
-		status.Type,
-	)
+	// remove extra file path characters.
+	name := caller.Name()
+	return name[strings.LastIndex(name, "/")+1:]
 }
 
-// formats and finalizes the log content
-func finalMessageWF(logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat, fields *Fields) string {
-	base := baseMessage(logCat, startTime, taskName, uuId, status)
-	msg := ""
-
-	for k, v := range *fields {
-		msg += fmt.Sprintf(`%s="%v", `, k, v)
+// sortedKeys returns the keys of fields in lexical order,
+// so encoders render the same fields the same way each time.
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
 	}
-
-	msg = strings.TrimRight(msg, ", ")
-
-	return base + ", " + msg
+	sort.Strings(keys)
+	return keys
 }
 
-// formats and finalizes the log content
-func finalMessage(logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat, v ...interface{}) string {
-	base := baseMessage(logCat, startTime, taskName, uuId, status)
-	msg := fmt.Sprint(v...)
-	wrappedMsg := fmt.Sprintf(`message="%s"`, msg)
-
-	return base + ", " + wrappedMsg
-}
-
-// formats and finalizes the log content
-func finalMessagef(logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat, format string, v ...interface{}) string {
-	base := baseMessage(logCat, startTime, taskName, uuId, status)
-	msg := fmt.Sprintf(format, v...)
-	wrappedMsg := fmt.Sprintf(`message="%s"`, msg)
-
-	return base + ", " + wrappedMsg
+// unixSeconds returns t in seconds since the epoch,
+// with a millisecond precision.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Millisecond)) / 1e3
 }
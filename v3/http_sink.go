@@ -0,0 +1,202 @@
+package apilogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPConfig configures an HTTPWriter.
+type HTTPConfig struct {
+	// URL the batches are sent to.
+	URL string
+
+	// Method of the requests, POST when empty.
+	Method string
+
+	// Header is added to every request, e.g. for authentication.
+	Header http.Header
+
+	// ContentType of the batches, application/x-ndjson when
+	// empty, which is what a JSONEncoder produces.
+	ContentType string
+
+	// Gzip compresses the batches.
+	Gzip bool
+
+	// Client sends the requests, a client with a 10s
+	// timeout when nil.
+	Client *http.Client
+
+	// Batch sets the size of the batches and their retries.
+	Batch BatchConfig
+}
+
+// HTTPWriter is a sink writer shipping the encoded entries to an
+// HTTP endpoint, in batches holding the concatenated entries. Sends
+// failing with a 5xx or 429 status, a timeout or any other transport
+// error are retried with exponential backoff, other statuses drop the
+// batch. Batches are sent in the background, Flush waits for them.
+type HTTPWriter struct {
+	cfg     HTTPConfig
+	batcher *batcher
+}
+
+// NewHTTPWriter returns an HTTPWriter for the config.
+func NewHTTPWriter(cfg HTTPConfig) (*HTTPWriter, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("apilogger: http sink without a url")
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/x-ndjson"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	h := &HTTPWriter{cfg: cfg}
+	h.batcher = newBatcher(cfg.Batch, h.send)
+	return h, nil
+}
+
+// Write implements io.Writer, adding p to the current batch.
+func (h *HTTPWriter) Write(p []byte) (int, error) {
+	entry := append([]byte(nil), p...)
+	if err := h.batcher.add(entry, len(entry)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush sends the current batch and waits until
+// every batch written so far is sent or dropped.
+func (h *HTTPWriter) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the current batch and stops the writer.
+func (h *HTTPWriter) Close() error {
+	return h.batcher.close()
+}
+
+// send posts the batch once.
+func (h *HTTPWriter) send(items []batchItem) error {
+	var body bytes.Buffer
+	var w io.Writer = &body
+
+	var zw *gzip.Writer
+	if h.cfg.Gzip {
+		zw = gzip.NewWriter(&body)
+		w = zw
+	}
+	for _, item := range items {
+		if _, err := w.Write(item.value.([]byte)); err != nil {
+			return permanent(err)
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return permanent(err)
+		}
+	}
+
+	req, err := http.NewRequest(h.cfg.Method, h.cfg.URL, &body)
+	if err != nil {
+		return permanent(err)
+	}
+	for k, vs := range h.cfg.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", h.cfg.ContentType)
+	if h.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	_, err = doBatchRequest(h.cfg.Client, req)
+	return err
+}
+
+// maxResponseSize caps the response bodies read by the shipping sinks.
+const maxResponseSize = 16 << 20
+
+// doBatchRequest sends the request of a batch and returns the
+// response body of a successful one. The failures not worth
+// retrying, statuses other than 5xx and 429, are permanent, and
+// so is a 2xx whose body cannot be read, as the batch was
+// accepted and sending it again would duplicate it.
+func doBatchRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		// timeouts and connection failures
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err != nil {
+			return body, permanent(err)
+		}
+		return body, nil
+	}
+
+	msg := bytes.TrimSpace(body)
+	if len(msg) > 512 {
+		msg = msg[:512]
+	}
+	httpErr := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Body:       string(msg),
+		RetryAfter: retryAfter(resp),
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, httpErr
+	}
+	return nil, permanent(httpErr)
+}
+
+// HTTPError is the error of a batch refused by the server.
+type HTTPError struct {
+	StatusCode int
+	// Body is the beginning of the response body
+	Body string
+	// RetryAfter is the delay asked by the Retry-After
+	// header of a 429 or 503, zero without one
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("apilogger: server responded %d", e.StatusCode)
+	}
+	return fmt.Sprintf("apilogger: server responded %d: %s", e.StatusCode, e.Body)
+}
+
+// retryAfter returns the delay asked by the Retry-After header of
+// a 429 or 503 response, in seconds or as a date, zero without one.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	v := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
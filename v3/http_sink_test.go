@@ -0,0 +1,270 @@
+package apilogger
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// collector is a stub log collector recording the batches received.
+type collector struct {
+	mu      sync.Mutex
+	batches []string
+	headers []http.Header
+	// fail returns the status to respond with to the
+	// given request, 200 when it returns zero
+	fail func(request int) int
+	hits int32
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := int(atomic.AddInt32(&c.hits, 1))
+	if c.fail != nil {
+		if status := c.fail(n); status != 0 {
+			http.Error(w, "unavailable", status)
+			return
+		}
+	}
+
+	var body []byte
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, _ = ioutil.ReadAll(zr)
+	} else {
+		body, _ = ioutil.ReadAll(r.Body)
+	}
+
+	c.mu.Lock()
+	c.batches = append(c.batches, string(body))
+	c.headers = append(c.headers, r.Header)
+	c.mu.Unlock()
+}
+
+func (c *collector) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.batches...)
+}
+
+// fastRetries is a BatchConfig retrying without noticeable delays.
+var fastRetries = BatchConfig{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestHTTPWriterBatches(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	batch := fastRetries
+	batch.MaxEntries = 3
+	batch.Interval = time.Hour
+	header := http.Header{"Authorization": {"Bearer token"}}
+	h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Header: header, Gzip: true, Batch: batch})
+	assertion.NoError(t, err)
+
+	logger := New(WithSink(Sink{Name: "http", Writer: h, Encoder: JSONEncoder{}}))
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		logger.Infof(ctx, LogCatDebug, StatusCatDebug, "%d", i)
+	}
+	// the last entry is sent by Sync
+	assertion.NoError(t, logger.Sync())
+	assertion.NoError(t, h.Close())
+
+	assert := assertion.New(t)
+	batches := c.received()
+	assert.Len(batches, 3)
+	assert.Equal(3, strings.Count(batches[0], "\n"))
+	assert.Equal(3, strings.Count(batches[1], "\n"))
+	assert.Equal(1, strings.Count(batches[2], "\n"))
+	assert.Contains(batches[2], `"message":"6"`)
+	assert.Equal("Bearer token", c.headers[0].Get("Authorization"))
+	assert.Equal("application/x-ndjson", c.headers[0].Get("Content-Type"))
+
+	_, err = h.Write([]byte("closed\n"))
+	assert.Error(err)
+	_, err = NewHTTPWriter(HTTPConfig{})
+	assert.Error(err)
+}
+
+func TestHTTPWriterFlushesOnInterval(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	batch := fastRetries
+	batch.Interval = 20 * time.Millisecond
+	h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Batch: batch})
+	assertion.NoError(t, err)
+	defer h.Close()
+
+	_, _ = h.Write([]byte("one\n"))
+	_, _ = h.Write([]byte("two\n"))
+	assertion.Eventually(t, func() bool {
+		return len(c.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assertion.Equal(t, "one\ntwo\n", c.received()[0])
+}
+
+func TestHTTPWriterRetries(t *testing.T) {
+	c := &collector{fail: func(n int) int {
+		if n <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Batch: fastRetries})
+	assertion.NoError(t, err)
+
+	_, _ = h.Write([]byte("retried\n"))
+	assertion.NoError(t, h.Close())
+	assertion.Equal(t, []string{"retried\n"}, c.received())
+	assertion.Equal(t, int32(3), atomic.LoadInt32(&c.hits))
+}
+
+func TestHTTPWriterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		hits   int32
+	}{
+		{"rejected", http.StatusBadRequest, 1},
+		{"unavailable", http.StatusBadGateway, 3},
+	}
+
+	for _, test := range tests {
+		c := &collector{fail: func(int) int { return test.status }}
+		server := httptest.NewServer(c)
+
+		var failures []error
+		var lost int
+		batch := fastRetries
+		batch.MaxRetries = 2
+		batch.OnError = func(err error, entries int) {
+			failures = append(failures, err)
+			lost += entries
+		}
+		h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Batch: batch})
+		assertion.NoError(t, err)
+
+		_, _ = h.Write([]byte("a\n"))
+		_, _ = h.Write([]byte("b\n"))
+		assertion.NoError(t, h.Close())
+		server.Close()
+
+		assert := assertion.New(t)
+		assert.Equal(test.hits, atomic.LoadInt32(&c.hits), test.name)
+		assert.Equal(2, lost, test.name)
+		if assert.Len(failures, 1, test.name) {
+			var httpErr *HTTPError
+			assert.True(errors.As(failures[0], &httpErr), test.name)
+			assert.Equal(test.status, httpErr.StatusCode, test.name)
+		}
+	}
+}
+
+func TestHTTPWriterRetryAfter(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	batch := fastRetries
+	batch.MaxBackoff = 5 * time.Second
+	h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Batch: batch})
+	assertion.NoError(t, err)
+
+	start := time.Now()
+	_, _ = h.Write([]byte("throttled\n"))
+	assertion.NoError(t, h.Close())
+	assertion.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	assertion.True(t, time.Since(start) >= time.Second, time.Since(start).String())
+}
+
+func TestHTTPWriterUnreadableSuccess(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		// the body is cut short of its announced length
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	var lost int
+	batch := fastRetries
+	batch.OnError = func(err error, entries int) { lost += entries }
+	h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Batch: batch})
+	assertion.NoError(t, err)
+
+	_, _ = h.Write([]byte("accepted\n"))
+	assertion.NoError(t, h.Close())
+	assertion.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	assertion.Equal(t, 1, lost)
+}
+
+func TestHTTPWriterTimeout(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 20 * time.Millisecond}
+	h, err := NewHTTPWriter(HTTPConfig{URL: server.URL, Client: client, Batch: fastRetries})
+	assertion.NoError(t, err)
+
+	_, _ = h.Write([]byte("slow\n"))
+	assertion.NoError(t, h.Close())
+	assertion.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestBatchRetryAfter(t *testing.T) {
+	cfg := BatchConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}.withDefaults()
+	assert := assertion.New(t)
+
+	assert.Equal(20*time.Millisecond, cfg.delay(0, &HTTPError{StatusCode: 429, RetryAfter: 20 * time.Millisecond}))
+	assert.Equal(cfg.MaxBackoff, cfg.delay(0, &HTTPError{StatusCode: 503, RetryAfter: time.Minute}))
+	assert.True(cfg.delay(0, &HTTPError{StatusCode: 503}) <= cfg.MinBackoff)
+
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(retryAfter(resp) > 59*time.Minute)
+	resp.StatusCode = http.StatusBadGateway
+	assert.Zero(retryAfter(resp))
+}
+
+func TestBatchBackoff(t *testing.T) {
+	cfg := BatchConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}.withDefaults()
+
+	for retry := 0; retry < 40; retry++ {
+		d := cfg.backoff(retry)
+		max := cfg.MaxBackoff
+		if retry < 3 {
+			max = cfg.MinBackoff << uint(retry)
+		}
+		assertion.True(t, d > 0 && d <= max, "retry %d: %s", retry, d)
+	}
+}
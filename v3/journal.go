@@ -0,0 +1,240 @@
+package apilogger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalSocket is the socket of the native protocol of systemd-journald.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// journalRetry is how long a JournalWriter writes to its fallback
+// before trying to reach the journal again.
+const journalRetry = 10 * time.Second
+
+// JournalWriter is a sink writer sending entries to systemd-journald
+// with its native protocol, keeping their structure as journal fields:
+// PRIORITY, CODE_FILE, CODE_LINE and CODE_FUNC from the caller,
+// APILOGGER_CODE, APILOGGER_TYPE, APILOGGER_STATUS, APILOGGER_UUID and
+// APILOGGER_TASK from the entry, APILOGGER_FIELD_<NAME> from its
+// fields and TRACE_ID, SPAN_ID and TRACE_FLAGS from the span it was
+// logged in. When the journal cannot be reached, e.g. outside systemd,
+// the entries encoded by the sink are written to Fallback instead.
+type JournalWriter struct {
+	// Socket is the path of the journal socket, JournalSocket when empty.
+	Socket string
+
+	// Identifier is the SYSLOG_IDENTIFIER of the entries,
+	// the name of the executable when empty.
+	Identifier string
+
+	// Fallback receives the encoded entries while the
+	// journal cannot be reached, os.Stderr when nil.
+	Fallback io.Writer
+
+	mu   sync.Mutex
+	conn net.Conn
+	// retryAt is when to try reaching the journal again
+	retryAt time.Time
+	closed  bool
+
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// NewJournalWriter returns a JournalWriter
+// for the default journal socket.
+func NewJournalWriter() *JournalWriter {
+	return &JournalWriter{}
+}
+
+// WriteEntry implements EntryWriter.
+func (j *JournalWriter) WriteEntry(e *Entry, p []byte) error {
+	fields := []jsonField{
+		{"PRIORITY", strconv.Itoa(syslogSeverity(e.Level))},
+		{"SYSLOG_IDENTIFIER", j.identifier()},
+		{"MESSAGE", journalMessage(e)},
+		{"CODE_FILE", e.Caller.File},
+		{"CODE_LINE", strconv.Itoa(e.Caller.Line)},
+		{"CODE_FUNC", e.Caller.Function},
+		{"APILOGGER_CODE", e.LogCat.Code},
+		{"APILOGGER_TYPE", e.LogCat.Type},
+		{"APILOGGER_STATUS", e.Status.Type},
+		{"APILOGGER_UUID", e.Context.UUID},
+		{"APILOGGER_TASK", e.Context.TaskName},
+	}
+	for _, f := range traceFields(e) {
+		fields = append(fields, jsonField{strings.ToUpper(f.key), f.value})
+	}
+	for _, k := range sortedKeys(e.Fields) {
+		fields = append(fields, jsonField{
+			"APILOGGER_FIELD_" + journalFieldName(k), fmt.Sprint(e.Fields[k]),
+		})
+	}
+
+	return j.send(journalPayload(fields), p)
+}
+
+// Write implements io.Writer, sending p as the MESSAGE of an
+// entry of informational priority.
+func (j *JournalWriter) Write(p []byte) (int, error) {
+	payload := journalPayload([]jsonField{
+		{"PRIORITY", strconv.Itoa(syslogSeverity(LevelInfo))},
+		{"SYSLOG_IDENTIFIER", j.identifier()},
+		{"MESSAGE", strings.TrimSuffix(string(p), "\n")},
+	})
+
+	if err := j.send(payload, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send sends the payload to the journal,
+// or writes p to the fallback writer.
+func (j *JournalWriter) send(payload, p []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return errWriterClosed
+	}
+
+	if j.connect() {
+		_, err := j.conn.Write(payload)
+		if err == nil {
+			return nil
+		}
+		// e.g. journald restarted or the entry is too large
+		// for a datagram, this entry goes to the fallback
+		j.conn.Close()
+		j.conn = nil
+	}
+
+	fallback := j.Fallback
+	if fallback == nil {
+		fallback = os.Stderr
+	}
+	_, err := fallback.Write(p)
+	return err
+}
+
+// connect reports whether the journal can be reached, connecting
+// to it unless a recent attempt failed. It must be called with mu held.
+func (j *JournalWriter) connect() bool {
+	if j.conn != nil {
+		return true
+	}
+
+	if j.now == nil {
+		j.now = time.Now
+	}
+	if j.now().Before(j.retryAt) {
+		return false
+	}
+
+	socket := j.Socket
+	if socket == "" {
+		socket = JournalSocket
+	}
+
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		j.retryAt = j.now().Add(journalRetry)
+		return false
+	}
+	j.conn = conn
+	return true
+}
+
+// Close closes the connection to the journal.
+func (j *JournalWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return errWriterClosed
+	}
+	j.closed = true
+
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+// identifier returns the SYSLOG_IDENTIFIER of the entries.
+func (j *JournalWriter) identifier() string {
+	if j.Identifier != "" {
+		return j.Identifier
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// journalMessage returns the message of the entry, or its
+// fields as logfmt pairs for the WF variants.
+func journalMessage(e *Entry) string {
+	if e.Fields == nil {
+		return e.Message
+	}
+	return logfmtFields(e.Fields)
+}
+
+// journalFieldName returns k as a journal field name: upper case
+// letters, digits and underscores only.
+func journalFieldName(k string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// journalPayload serializes the non empty fields in the native
+// journal protocol, values containing a newline in its binary form.
+func journalPayload(fields []jsonField) []byte {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		value, _ := f.value.(string)
+		if value == "" {
+			continue
+		}
+
+		buf.WriteString(f.key)
+		if !strings.Contains(value, "\n") {
+			buf.WriteByte('=')
+			buf.WriteString(value)
+			buf.WriteByte('\n')
+			continue
+		}
+
+		buf.WriteByte('\n')
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+		buf.Write(size[:])
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
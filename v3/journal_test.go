@@ -0,0 +1,125 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// parseJournal decodes a native journal protocol payload.
+func parseJournal(t *testing.T, payload []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(payload) > 0 {
+		nl := bytes.IndexByte(payload, '\n')
+		if nl < 0 {
+			t.Fatalf("unterminated field %q", payload)
+		}
+		line := string(payload[:nl])
+		payload = payload[nl+1:]
+
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			fields[line[:eq]] = line[eq+1:]
+			continue
+		}
+
+		// binary form: name, newline, little endian size, value, newline
+		size := int(binary.LittleEndian.Uint64(payload[:8]))
+		fields[line] = string(payload[8 : 8+size])
+		payload = payload[8+size+1:]
+	}
+	return fields
+}
+
+// listenJournal returns a local datagram socket standing in for journald.
+func listenJournal(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unix datagram sockets are not supported:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+func readJournal(t *testing.T, conn *net.UnixConn) map[string]string {
+	buf := make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseJournal(t, buf[:n])
+}
+
+func TestJournalWriter(t *testing.T) {
+	conn, path := listenJournal(t)
+	j := &JournalWriter{Socket: path, Identifier: "task"}
+	defer j.Close()
+
+	logger := New(WithSink(Sink{Name: "journal", Writer: j}))
+	ctx := NewContextLogger(context.Background(), "journal")
+	assert := assertion.New(t)
+
+	logger.Warn(ctx, LogCatStartUp, StatusCatPending, "first line\nsecond line")
+	fields := readJournal(t, conn)
+	assert.Equal("4", fields["PRIORITY"])
+	assert.Equal("task", fields["SYSLOG_IDENTIFIER"])
+	assert.Equal("first line\nsecond line", fields["MESSAGE"])
+	assert.Equal("journal_test.go", filepath.Base(fields["CODE_FILE"]))
+	assert.NotEmpty(fields["CODE_LINE"])
+	assert.Equal("v3.TestJournalWriter", fields["CODE_FUNC"])
+	assert.Equal(LogCatStartUp.Code, fields["APILOGGER_CODE"])
+	assert.Equal(LogCatStartUp.Type, fields["APILOGGER_TYPE"])
+	assert.Equal(StatusCatPending.Type, fields["APILOGGER_STATUS"])
+	assert.Equal("journal", fields["APILOGGER_TASK"])
+	assert.NotEmpty(fields["APILOGGER_UUID"])
+
+	logger.ErrorWF(ctx, LogCatDebug, StatusCatFailed, &Fields{"retry-count": 3, "reason": "timeout"})
+	fields = readJournal(t, conn)
+	assert.Equal("3", fields["PRIORITY"])
+	assert.Equal("reason=timeout retry-count=3", fields["MESSAGE"])
+	assert.Equal("3", fields["APILOGGER_FIELD_RETRY_COUNT"])
+	assert.Equal("timeout", fields["APILOGGER_FIELD_REASON"])
+
+	_, err := j.Write([]byte("plain\n"))
+	assert.NoError(err)
+	fields = readJournal(t, conn)
+	assert.Equal("plain", fields["MESSAGE"])
+	assert.Equal("6", fields["PRIORITY"])
+}
+
+func TestJournalWriterFallback(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	var fallback bytes.Buffer
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	j := &JournalWriter{Socket: path, Fallback: &fallback, now: clock.Now}
+	defer j.Close()
+
+	logger := New(WithSink(Sink{Name: "journal", Writer: j}))
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "no journal")
+	assert.Equal([]string{"no journal"}, messages(fallback.String()))
+
+	// the journal shows up, it is used once the retry delay elapsed
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unix datagram sockets are not supported:", err)
+	}
+	defer conn.Close()
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "still no journal")
+	clock.Add(journalRetry)
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "to journal")
+
+	assert.Equal([]string{"no journal", "still no journal"}, messages(fallback.String()))
+	assert.Equal("to journal", readJournal(t, conn)["MESSAGE"])
+}
@@ -0,0 +1,119 @@
+package apilogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonTimeFormat is the layout of the "time" key of JSON lines.
+const jsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// JSONEncoder renders every entry as a single JSON object per
+// line. Fields are written as native JSON types after the
+// standard keys; a field named like a standard key is written
+// as "fields.<name>" so it cannot override it. Entries logged
+// in a span also have the trace_id, span_id and trace_flags keys.
+type JSONEncoder struct{}
+
+// jsonField is a single key/value pair of a JSON line,
+// kept in a slice so the keys are written in a stable order.
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// entryFields returns the standard keys of an entry in the order
+// they are written, followed by its trace keys and, for an entry
+// without fields, its message. The time key is left out when t is nil.
+func entryFields(e *Entry, t, ms interface{}) []jsonField {
+	line := []jsonField{{"level", e.Level.String()}}
+	if t != nil {
+		line = append(line, jsonField{"time", t})
+	}
+	line = append(line,
+		jsonField{"uuid", e.Context.UUID},
+		jsonField{"taskName", e.Context.TaskName},
+		jsonField{"location", e.Caller.Location()},
+		jsonField{"ms", ms},
+		jsonField{"function", e.Caller.Function},
+		jsonField{"code", e.LogCat.Code},
+		jsonField{"type", e.LogCat.Type},
+		jsonField{"status", e.Status.Type},
+	)
+	line = append(line, traceFields(e)...)
+
+	if e.Fields == nil {
+		line = append(line, jsonField{"message", e.Message})
+	}
+	return line
+}
+
+// appendFields appends the fields of e to line, sorted by key.
+// The keys are first passed through sanitize, when not nil, and
+// then renamed by fieldKey if they match a key of line, so a
+// field cannot be sanitized into a standard key.
+func appendFields(line []jsonField, e *Entry, sanitize func(string) string) []jsonField {
+	reserved := make(map[string]bool, len(line))
+	for _, f := range line {
+		reserved[f.key] = true
+	}
+
+	for _, k := range sortedKeys(e.Fields) {
+		key := k
+		if sanitize != nil {
+			key = sanitize(k)
+		}
+		line = append(line, jsonField{fieldKey(key, reserved), e.Fields[k]})
+	}
+	return line
+}
+
+// Encode implements Encoder.
+func (JSONEncoder) Encode(w io.Writer, e *Entry) error {
+	line := appendFields(entryFields(e, e.Time.Format(jsonTimeFormat), msElapsed(e)), e, nil)
+
+	var buf bytes.Buffer
+	writeJSONLine(&buf, line)
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeJSONLine renders the fields as a single JSON object.
+func writeJSONLine(buf *bytes.Buffer, fields []jsonField) {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONValue(buf, f.key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, f.value)
+	}
+	buf.WriteByte('}')
+}
+
+// writeJSONValue writes v as a JSON value. Errors are written
+// as their message and values that cannot be marshalled fall
+// back to their default string representation.
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		if _, ok := v.(json.Marshaler); !ok {
+			v = err.Error()
+		}
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		b.Reset()
+		_ = enc.Encode(fmt.Sprint(v))
+	}
+
+	// Encode terminates every value with a newline
+	buf.Write(bytes.TrimRight(b.Bytes(), "\n"))
+}
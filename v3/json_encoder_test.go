@@ -0,0 +1,109 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// jsonRecord encodes the entry with the JSONEncoder and decodes it back.
+func jsonRecord(t *testing.T, e *Entry) map[string]interface{} {
+	var buf bytes.Buffer
+	if err := (JSONEncoder{}).Encode(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestJSONEncoder(t *testing.T) {
+	logCat := LogCatStartUp
+	e := testEntry(logCat)
+	e.Message = `hello "test"`
+	record := jsonRecord(t, e)
+	assert := assertion.New(t)
+
+	assert.Equal("INFO", record["level"])
+	assert.Equal("UpdatePassword", record["taskName"])
+	assert.Equal("12345zw", record["uuid"])
+	assert.Equal(logCat.Code, record["code"])
+	assert.Equal(logCat.Type, record["type"])
+	assert.Equal(StatusCatPending.Type, record["status"])
+	assert.Equal(`hello "test"`, record["message"])
+	assert.IsType(float64(0), record["ms"])
+
+	for _, key := range []string{"time", "location", "function"} {
+		assert.Contains(record, key)
+	}
+}
+
+func TestJSONEncoderNoStartTime(t *testing.T) {
+	e := testEntry(LogCatStartUp)
+	e.Level = LevelWarn
+	e.Context.StartTime = time.Time{}
+	record := jsonRecord(t, e)
+	assert := assertion.New(t)
+
+	assert.Equal("WARN", record["level"])
+	assert.Equal(float64(0), record["ms"])
+}
+
+func TestJSONEncoderFields(t *testing.T) {
+	e := testEntry(LogCatStartUp)
+	e.Fields = Fields{
+		"count":  3,
+		"ok":     true,
+		"nested": map[string]int{"a": 1},
+		"error":  errors.New("my error message"),
+		"code":   "overridden",
+	}
+	record := jsonRecord(t, e)
+	assert := assertion.New(t)
+
+	assert.Equal(float64(3), record["count"])
+	assert.Equal(true, record["ok"])
+	assert.Equal(map[string]interface{}{"a": float64(1)}, record["nested"])
+	assert.Equal("my error message", record["error"])
+	assert.Equal(LogCatStartUp.Code, record["code"])
+	assert.Equal("overridden", record["fields.code"])
+	assert.NotContains(record, "message")
+}
+
+func TestLoggerJSONEncoder(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	logger := New(WithEncoder(JSONEncoder{}))
+	logger.output = &out
+	logger.errOutput = &errOut
+
+	ctx := NewContextLogger(context.Background(), "json-task")
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "info message")
+	logger.Warnf(ctx, LogCatDebug, StatusCatDebug, "warn %d", 1)
+	logger.ErrorWF(ctx, LogCatDebug, StatusCatFailed, &Fields{"step": "001"})
+
+	assert := assertion.New(t)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(lines, 2)
+	for _, line := range lines {
+		assert.True(json.Valid([]byte(line)), line)
+	}
+
+	var record map[string]interface{}
+	assert.NoError(json.Unmarshal(errOut.Bytes(), &record))
+	assert.Equal("ERROR", record["level"])
+	assert.Equal("json-task", record["taskName"])
+	assert.Equal("001", record["step"])
+	assert.True(strings.HasPrefix(record["location"].(string), "json_encoder_test.go:"))
+	assert.Equal("v3.TestLoggerJSONEncoder", record["function"])
+}
@@ -0,0 +1,88 @@
+package apilogger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of a log entry. The zero
+// value is LevelInfo, the default minimum level.
+type Level int8
+
+const (
+	// LevelTrace is used for the most detailed
+	// entries, e.g. every step of a loop.
+	LevelTrace Level = iota - 2
+
+	// LevelDebug is used for debugging entries that
+	// are usually silenced in production.
+	LevelDebug
+
+	// LevelInfo is used for informational entries.
+	LevelInfo
+
+	// LevelWarn is used for entries that need attention
+	// but do not stop the current operation.
+	LevelWarn
+
+	// LevelError is used for failed operations.
+	LevelError
+
+	// LevelFatal is used right before the process exits.
+	LevelFatal
+
+	// LevelOff is only used as a minimum level,
+	// to drop every entry.
+	LevelOff
+)
+
+// String returns the upper-case name of the level
+// as it is printed at the start of text lines.
+func (lvl Level) String() string {
+	switch lvl {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	case LevelOff:
+		return "OFF"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", lvl)
+	}
+}
+
+// ParseLevel returns the level of the given case-insensitive name.
+func ParseLevel(name string) (Level, error) {
+	for lvl := LevelTrace; lvl <= LevelOff; lvl++ {
+		if strings.EqualFold(name, lvl.String()) {
+			return lvl, nil
+		}
+	}
+	if strings.EqualFold(name, "WARNING") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (lvl Level) MarshalText() ([]byte, error) {
+	return []byte(lvl.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (lvl *Level) UnmarshalText(text []byte) error {
+	parsed, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*lvl = parsed
+	return nil
+}
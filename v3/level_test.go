@@ -0,0 +1,118 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// formatSpy records whether it has been formatted.
+type formatSpy struct {
+	formatted *bool
+}
+
+func (s formatSpy) String() string {
+	*s.formatted = true
+	return "spy"
+}
+
+func TestParseLevel(t *testing.T) {
+	assert := assertion.New(t)
+
+	for _, lvl := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal} {
+		parsed, err := ParseLevel(strings.ToLower(lvl.String()))
+		assert.NoError(err)
+		assert.Equal(lvl, parsed)
+	}
+
+	parsed, err := ParseLevel("warning")
+	assert.NoError(err)
+	assert.Equal(LevelWarn, parsed)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(err)
+}
+
+func TestMinimumLevel(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	logger := New(WithLevel(LevelWarn))
+	logger.output = &out
+	logger.errOutput = &errOut
+
+	ctx := context.Background()
+	formatted := false
+	spy := formatSpy{&formatted}
+
+	logger.Trace(ctx, LogCatDebug, StatusCatDebug, spy)
+	logger.Debugf(ctx, LogCatDebug, StatusCatDebug, "%v", spy)
+	logger.InfoWF(ctx, LogCatDebug, StatusCatDebug, &Fields{"spy": spy})
+	Debug(ctx, LogCatDebug, StatusCatDebug, spy)
+	logger.Warn(ctx, LogCatDebug, StatusCatDebug, "kept")
+	logger.Error(ctx, LogCatDebug, StatusCatFailed, "kept")
+
+	assert := assertion.New(t)
+	assert.False(formatted)
+	assert.Equal(1, strings.Count(out.String(), "\n"))
+	assert.True(strings.HasPrefix(out.String(), "WARN "))
+	assert.True(strings.HasPrefix(errOut.String(), "ERROR "))
+}
+
+func TestDebugAndTraceLevels(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := New()
+	logger.output = &out
+
+	ctx := context.Background()
+	logger.Debug(ctx, LogCatDebug, StatusCatDebug, "hidden")
+	assertion.Empty(t, out.String())
+
+	logger.SetLevel(LevelTrace)
+	assertion.Equal(t, LevelTrace, logger.Level())
+
+	logger.Trace(ctx, LogCatDebug, StatusCatDebug, "trace message")
+	logger.Tracef(ctx, LogCatDebug, StatusCatDebug, "trace %s", "formatted")
+	logger.TraceWF(ctx, LogCatDebug, StatusCatDebug, &Fields{"step": 1})
+	logger.Debug(ctx, LogCatDebug, StatusCatDebug, "debug message")
+	logger.Debugf(ctx, LogCatDebug, StatusCatDebug, "debug %s", "formatted")
+	logger.DebugWF(ctx, LogCatDebug, StatusCatDebug, &Fields{"step": 2})
+	Tracef(ctx, LogCatDebug, StatusCatDebug, "global %s", "trace")
+	DebugWF(ctx, LogCatDebug, StatusCatDebug, &Fields{"step": 3})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert := assertion.New(t)
+	assert.Len(lines, 8)
+	for i, prefix := range []string{"TRACE ", "TRACE ", "TRACE ", "DEBUG ", "DEBUG ", "DEBUG ", "TRACE ", "DEBUG "} {
+		assert.True(strings.HasPrefix(lines[i], prefix), lines[i])
+		assert.Contains(lines[i], `function="v3.TestDebugAndTraceLevels"`)
+	}
+	assert.Contains(lines[1], `message="trace formatted"`)
+	assert.Contains(lines[5], `step="2"`)
+}
+
+func TestCategoryLevel(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := New(WithLevel(LevelWarn))
+	logger.output = &out
+	logger.SetCategoryLevel(LogCatKafkaConsume.Code, LevelDebug)
+	logger.SetCategoryLevel(LogCatHealth.Code, LevelError)
+
+	ctx := context.Background()
+	logger.Debug(ctx, LogCatKafkaConsume, StatusCatDebug, "kept")
+	logger.Warn(ctx, LogCatHealth, StatusCatPending, "dropped")
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "dropped")
+
+	assert := assertion.New(t)
+	assert.Equal(1, strings.Count(out.String(), "\n"))
+	assert.Contains(out.String(), `code="KFK007"`)
+
+	logger.ClearCategoryLevel(LogCatHealth.Code)
+	logger.Warn(ctx, LogCatHealth, StatusCatPending, "kept")
+	assert.Equal(2, strings.Count(out.String(), "\n"))
+	assert.Equal(map[string]Level{LogCatKafkaConsume.Code: LevelDebug}, logger.CategoryLevels())
+}
@@ -0,0 +1,106 @@
+package apilogger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LogfmtEncoder renders entries as strict logfmt lines,
+// space separated key=value pairs without any prefix.
+// Values are quoted whenever they contain a space, an
+// equals sign, a quote or any character that needs
+// escaping, and keys are stripped of such characters,
+// so user data can neither break out of its value nor
+// start a new line. A field named like a standard key
+// is written as "fields.<name>". Entries logged in a span
+// also have the trace_id, span_id and trace_flags keys.
+type LogfmtEncoder struct{}
+
+// Encode implements Encoder.
+func (LogfmtEncoder) Encode(w io.Writer, e *Entry) error {
+	ms := strconv.FormatFloat(msElapsed(e), 'f', 6, 64)
+	line := appendFields(entryFields(e, e.Time.Format(jsonTimeFormat), ms), e, logfmtKey)
+
+	var buf bytes.Buffer
+	for i, f := range line {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(f.key))
+		buf.WriteByte('=')
+		writeLogfmtValue(&buf, fmt.Sprint(f.value))
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// logfmtFields returns the fields as space separated
+// logfmt pairs, sorted by key.
+func logfmtFields(fields Fields) string {
+	var buf bytes.Buffer
+	for i, k := range sortedKeys(fields) {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(k))
+		buf.WriteByte('=')
+		writeLogfmtValue(&buf, fmt.Sprint(fields[k]))
+	}
+	return buf.String()
+}
+
+// fieldKey returns the key a field is written under, prefixing
+// it with "fields." when it would override a standard key.
+func fieldKey(k string, reserved map[string]bool) string {
+	if reserved[k] {
+		return "fields." + k
+	}
+	return k
+}
+
+// logfmtKey replaces every character that is not allowed in a
+// key (spaces, '=', '"', control and non printable characters)
+// with an underscore.
+func logfmtKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// writeLogfmtValue writes v bare when it is safe to do so,
+// and as an escaped, quoted string otherwise.
+func writeLogfmtValue(buf *bytes.Buffer, v string) {
+	if needsQuoting(v) {
+		buf.WriteString(strconv.Quote(v))
+		return
+	}
+	buf.WriteString(v)
+}
+
+// needsQuoting reports whether v has to be quoted in a logfmt line.
+func needsQuoting(v string) bool {
+	if v == "" {
+		return true
+	}
+
+	for _, r := range v {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package apilogger
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// hostile values trying to forge fields or whole log lines.
+var hostilePayloads = []string{
+	`x", code="EVIL", uuid="forged`,
+	`x" code="EVIL" uuid="forged`,
+	"line one\nINFO 2024/09/23 11:29:55 uuid=\"forged\", code=\"EVIL\"",
+	"carriage\rreturn and \x1b[31mescape\x00null",
+	`back\slash\" code=EVIL`,
+	"separator line",
+	"invalid \xff utf8",
+}
+
+type logfmtPair struct {
+	key   string
+	value string
+}
+
+// parseLogfmt splits a line in key=value pairs the way a log
+// pipeline would, accepting both the text and logfmt layouts.
+func parseLogfmt(t *testing.T, line string) []logfmtPair {
+	var pairs []logfmtPair
+
+	for line != "" {
+		line = strings.TrimLeft(line, ", ")
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			t.Fatalf("missing '=' in %q", line)
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				t.Fatalf("unterminated value in %q", line)
+			}
+			value, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				t.Fatalf("invalid quoted value %q: %v", line[:end+1], err)
+			}
+			pairs = append(pairs, logfmtPair{key, value})
+			line = line[end+1:]
+			continue
+		}
+
+		end := strings.IndexAny(line, " ,")
+		if end < 0 {
+			end = len(line)
+		}
+		pairs = append(pairs, logfmtPair{key, line[:end]})
+		line = line[end:]
+	}
+
+	return pairs
+}
+
+// values returns all values recorded under key.
+func values(pairs []logfmtPair, key string) []string {
+	var vs []string
+	for _, p := range pairs {
+		if p.key == key {
+			vs = append(vs, p.value)
+		}
+	}
+	return vs
+}
+
+func TestEncodersEscapeHostileMessages(t *testing.T) {
+	encoders := map[string]Encoder{
+		"text":   TextEncoder{},
+		"logfmt": LogfmtEncoder{},
+	}
+
+	for name, encoder := range encoders {
+		for _, payload := range hostilePayloads {
+			e := testEntry(LogCatUnmarshalReq)
+			e.Message = payload
+
+			var buf bytes.Buffer
+			assertion.NoError(t, encoder.Encode(&buf, e))
+			output := buf.String()
+			assert := assertion.New(t)
+
+			assert.Equal(1, strings.Count(output, "\n"), "%s: %q", name, output)
+			assert.NotContains(output, "\r", name)
+			assert.True(strings.HasSuffix(output, "\n"), "%s: %q", name, output)
+
+			line := strings.TrimSuffix(output, "\n")
+			if name == "text" {
+				// skip the level and date prefix
+				line = strings.SplitN(line, " ", 4)[3]
+			}
+			pairs := parseLogfmt(t, line)
+
+			assert.Equal([]string{LogCatUnmarshalReq.Code}, values(pairs, "code"), "%s: %q", name, output)
+			assert.Equal([]string{"12345zw"}, values(pairs, "uuid"), "%s: %q", name, output)
+			assert.Equal([]string{payload}, values(pairs, "message"), "%s: %q", name, output)
+		}
+	}
+}
+
+func TestEncodersEscapeHostileFields(t *testing.T) {
+	encoders := map[string]Encoder{
+		"text":   TextEncoder{},
+		"logfmt": LogfmtEncoder{},
+	}
+
+	for name, encoder := range encoders {
+		e := testEntry(LogCatUnmarshalReq)
+		e.Fields = Fields{
+			"code":                 "EVIL",
+			"uuid":                 "forged",
+			`x", code="EVIL`:       "value",
+			"payload":              hostilePayloads[0],
+			"new\nline":            hostilePayloads[2],
+			"spaced key=something": 1,
+		}
+
+		var buf bytes.Buffer
+		assertion.NoError(t, encoder.Encode(&buf, e))
+		output := buf.String()
+		assert := assertion.New(t)
+
+		assert.Equal(1, strings.Count(output, "\n"), "%s: %q", name, output)
+
+		line := strings.TrimSuffix(output, "\n")
+		if name == "text" {
+			line = strings.SplitN(line, " ", 4)[3]
+		}
+		pairs := parseLogfmt(t, line)
+
+		assert.Equal([]string{LogCatUnmarshalReq.Code}, values(pairs, "code"), "%s: %q", name, output)
+		assert.Equal([]string{"12345zw"}, values(pairs, "uuid"), "%s: %q", name, output)
+		assert.Equal([]string{"EVIL"}, values(pairs, "fields.code"), "%s: %q", name, output)
+		assert.Equal([]string{"forged"}, values(pairs, "fields.uuid"), "%s: %q", name, output)
+		assert.Equal([]string{hostilePayloads[0]}, values(pairs, "payload"), "%s: %q", name, output)
+		assert.Equal([]string{hostilePayloads[2]}, values(pairs, "new_line"), "%s: %q", name, output)
+		assert.Equal([]string{"1"}, values(pairs, "spaced_key_something"), "%s: %q", name, output)
+		assert.Equal([]string{"value"}, values(pairs, "x_,_code__EVIL"), "%s: %q", name, output)
+	}
+}
+
+func TestEncodersSanitizeKeysBeforeReservedCheck(t *testing.T) {
+	encoders := map[string]Encoder{
+		"text":   TextEncoder{},
+		"logfmt": LogfmtEncoder{},
+	}
+
+	for name, encoder := range encoders {
+		e := testEntry(LogCatUnmarshalReq)
+		e.Trace, _ = ParseTraceparent(testTraceparent)
+		e.Fields = Fields{
+			"trace id": "forged",
+			"span\nid": "forged",
+		}
+
+		var buf bytes.Buffer
+		assertion.NoError(t, encoder.Encode(&buf, e))
+		output := buf.String()
+		assert := assertion.New(t)
+
+		line := strings.TrimSuffix(output, "\n")
+		if name == "text" {
+			line = strings.SplitN(line, " ", 4)[3]
+		}
+		pairs := parseLogfmt(t, line)
+
+		assert.Equal([]string{"4bf92f3577b34da6a3ce929d0e0e4736"}, values(pairs, "trace_id"), "%s: %q", name, output)
+		assert.Equal([]string{"00f067aa0ba902b7"}, values(pairs, "span_id"), "%s: %q", name, output)
+		assert.Equal([]string{"forged"}, values(pairs, "fields.trace_id"), "%s: %q", name, output)
+		assert.Equal([]string{"forged"}, values(pairs, "fields.span_id"), "%s: %q", name, output)
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	e := testEntry(LogCatStartUp)
+	e.Message = "hello test"
+
+	var buf bytes.Buffer
+	assertion.NoError(t, LogfmtEncoder{}.Encode(&buf, e))
+	output := buf.String()
+	assert := assertion.New(t)
+
+	assert.True(strings.HasPrefix(output, "level=INFO time="), output)
+	assert.Contains(output, " uuid=12345zw taskName=UpdatePassword ")
+	assert.Contains(output, " code=STT001 type=service_startup status=Pending ")
+	assert.True(strings.HasSuffix(output, ` message="hello test"`+"\n"), output)
+}
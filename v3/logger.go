@@ -1,10 +1,14 @@
 package apilogger
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,21 +34,49 @@ const (
 
 	// Depth of the callstack - needed to determine
 	// the initial caller function
-	depth int = 6
-
-	prefixInfo  = "INFO "
-	prefixWarn  = "WARN "
-	prefixError = "ERROR "
-	prefixFatal = "FATAL "
+	depth int = 4
 )
 
 // Logger struct
 type Logger struct {
-	infoLog    *log.Logger
-	warningLog *log.Logger
-	errorLog   *log.Logger
-	output     io.Writer
-	errOutput  io.Writer
+	// mu guards the outputs and serializes the writes
+	// to them, so lines are never interleaved
+	mu        sync.Mutex
+	output    io.Writer
+	errOutput io.Writer
+	encoder   Encoder
+
+	// level is the minimum Level of the entries
+	// written, accessed atomically.
+	level int32
+
+	// categories holds the *compiledPolicy of the
+	// minimum levels set per LogCat code.
+	categories   atomic.Value
+	categoriesMu sync.Mutex
+
+	// closers are the files opened by the Logger, and
+	// stdOutput and stdErrOutput the outputs restored by Close
+	closers      []io.Closer
+	stdOutput    io.Writer
+	stdErrOutput io.Writer
+
+	// async queues the entries written in the
+	// background, nil unless WithAsync is used
+	async *asyncQueue
+
+	// sinks replace the outputs once added, guarded by mu
+	sinks []*sink
+
+	// writers are the writers registered for routes, which
+	// map levels to writer names, both guarded by mu
+	writers map[string]io.Writer
+	routes  Routes
+
+	// traceExtractor and spanEvents correlate the
+	// entries with spans, both nil unless set
+	traceExtractor TraceExtractor
+	spanEvents     SpanEventRecorder
 
 	// requestID  string
 	// apiKey     string
@@ -54,240 +86,478 @@ type Logger struct {
 
 type Fields map[string]interface{}
 
+// Option configures a Logger at construction time.
+type Option func(*Logger)
+
+// WithEncoder sets the encoder used to render log lines,
+// TextEncoder is used when none is set.
+func WithEncoder(encoder Encoder) Option {
+	return func(l *Logger) {
+		l.encoder = encoder
+	}
+}
+
+// WithLevel sets the minimum level of the entries written,
+// LevelInfo is used when none is set.
+func WithLevel(level Level) Option {
+	return func(l *Logger) {
+		l.SetLevel(level)
+	}
+}
+
+// WithPolicy sets the minimum levels per LogCat code, see Policy.
+func WithPolicy(policy Policy) Option {
+	return func(l *Logger) {
+		l.SetPolicy(policy)
+	}
+}
+
 var defaultLogger *Logger
 
+// bufferPool holds the buffers entries are encoded to.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// exit terminates the process after Fatal entries,
+// replaced in tests.
+var exit = os.Exit
+
 // New returns a new Logger instance.
-func New() *Logger {
+func New(opts ...Option) *Logger {
 	defaultLogger = &Logger{
 		output:    os.Stdout,
 		errOutput: os.Stderr,
 	}
+	for _, opt := range opts {
+		opt(defaultLogger)
+	}
 	return defaultLogger
 }
 
 // Set logger to file
 func (l *Logger) SetOutputFile(outPath string) error {
-	file, err := os.OpenFile(
-		outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	file, err := openLogFile(outPath)
+	if err != nil {
+		log.Println("Failed to open log file", err)
+		return err
+	}
+
+	l.addFile(file)
+	return nil
+}
 
+// SetOutputRotatingFile sets the logger to a file rotated
+// according to cfg, see RotatingFile.
+func (l *Logger) SetOutputRotatingFile(cfg RotateConfig) error {
+	file, err := NewRotatingFile(cfg)
 	if err != nil {
 		log.Println("Failed to open log file", err)
 		return err
 	}
 
+	l.addFile(file)
+	return nil
+}
+
+// addFile adds a file opened by the Logger to its outputs.
+func (l *Logger) addFile(file io.WriteCloser) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.closers) == 0 {
+		l.stdOutput, l.stdErrOutput = l.output, l.errOutput
+	}
+	l.closers = append(l.closers, file)
+
 	l.output = io.MultiWriter(file, l.output)
 	l.errOutput = io.MultiWriter(file, l.errOutput)
-	return nil
 }
 
-// prints message.
-func (l *Logger) printlnWF(logger *log.Logger, logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat, fields *Fields) {
-	logger.Println(finalMessageWF(logCat, startTime, taskName, uuId, status, fields))
+// syncer is implemented by the files that can be synced.
+type syncer interface {
+	Sync() error
 }
 
-func (l *Logger) println(logger *log.Logger, logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat, v ...interface{}) {
-	logger.Println(finalMessage(logCat, startTime, taskName, uuId, status, v...))
+// Sync commits the lines written to the files of the Logger to
+// stable storage, once the queued entries of an asynchronous
+// Logger are written, and flushes the writers of its sinks
+// buffering entries, such as an HTTPWriter.
+func (l *Logger) Sync() error {
+	if l.async != nil {
+		l.async.flush()
+	}
+
+	l.mu.Lock()
+	sinks := l.sinks
+	err := l.sync()
+	l.mu.Unlock()
+
+	// flushed without holding mu, the writers
+	// may take a while to send their entries
+	for _, s := range sinks {
+		if f, ok := s.Writer.(flusher); ok {
+			if flushErr := f.Flush(); err == nil {
+				err = flushErr
+			}
+		}
+	}
+	return err
 }
 
-func (l *Logger) printlnf(logger *log.Logger, logCat LogCat, startTime time.Time, taskName, uuId string, status StatusCat, format string, v ...interface{}) {
-	logger.Println(finalMessagef(logCat, startTime, taskName, uuId, status, format, v...))
+// flusher is implemented by the writers buffering entries.
+type flusher interface {
+	Flush() error
 }
 
-func (l *Logger) Info(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+// sync syncs the files. It must be called with mu held.
+func (l *Logger) sync() error {
+	var err error
+	for _, c := range l.closers {
+		if s, ok := c.(syncer); ok {
+			if syncErr := s.Sync(); err == nil {
+				err = syncErr
+			}
+		}
 	}
+	return err
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+// Close syncs and closes the files opened by SetOutputFile and
+// SetOutputRotatingFile. Lines logged afterwards are only written
+// to the standard outputs. An asynchronous Logger writes its queued
+// entries first and writes the later ones synchronously.
+func (l *Logger) Close() error {
+	if l.async != nil {
+		l.async.close()
+	}
 
-	l.println(l.infoLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, v...)
-}
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-func (l *Logger) Infof(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+	if len(l.closers) == 0 {
+		return nil
 	}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+	err := l.sync()
+	for _, c := range l.closers {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
 
-	l.printlnf(l.infoLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, format, v...)
+	l.output, l.errOutput = l.stdOutput, l.stdErrOutput
+	l.closers = nil
+	l.stdOutput, l.stdErrOutput = nil, nil
+	return err
 }
 
-func (l *Logger) InfoWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	if l.infoLog == nil {
-		l.infoLog = log.New(l.output, prefixInfo, log.Ldate|log.Ltime)
+// exitFatal syncs the files and terminates the process
+// once a Fatal entry was written.
+func (l *Logger) exitFatal() {
+	if err := l.Sync(); err != nil {
+		log.Println("Failed to sync log file", err)
 	}
+	exit(1)
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+// SetLevel changes the minimum level of the entries written.
+// It is safe to call while other goroutines are logging.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
 
-	l.printlnWF(l.infoLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, fields)
+// Level returns the minimum level of the entries written.
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
 }
 
-func (l *Logger) Printf(status StatusCat, s string, i ...interface{}) {
-	l.Infof(context.TODO(), LogCatDebug, status, s, i...)
+// enabled reports whether entries of the given level and LogCat are
+// written. It is checked before the caller is resolved and the message
+// is formatted, so disabled entries cost next to nothing.
+func (l *Logger) enabled(level Level, logCat LogCat) bool {
+	if min, ok := l.policy().lookup(logCat.Code); ok {
+		return level >= min
+	}
+	return level >= l.Level()
+}
+
+// trace sets the trace context of the span active in ctx on the
+// entry, and records the entry as an event of its span. Events
+// are recorded before the entry is queued, while the span of the
+// log call is still recording.
+func (l *Logger) trace(ctx context.Context, e *Entry) {
+	if l.traceExtractor != nil {
+		if tc, ok := l.traceExtractor(ctx); ok && tc.IsValid() {
+			e.Trace = tc
+		}
+	}
+	if l.spanEvents != nil && e.Trace.IsValid() {
+		l.spanEvents(ctx, e)
+	}
 }
 
-func (l *Logger) Warn(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+// write writes the entry, through the queue of an asynchronous
+// Logger. Fatal entries are written once the queue is flushed,
+// so they are never dropped and come last.
+func (l *Logger) write(e *Entry) {
+	if l.async != nil {
+		if e.Level >= LevelFatal {
+			l.async.flush()
+		} else if l.async.put(e) {
+			return
+		}
+	}
+	l.writeEntry(e)
+}
+
+// writeEntry encodes the entry and writes it to the writers its level
+// is routed to, or to the sinks of the Logger when there are any.
+func (l *Logger) writeEntry(e *Entry) {
+	l.mu.Lock()
+	sinks := l.sinks
+	l.mu.Unlock()
+	if len(sinks) > 0 {
+		l.writeSinks(sinks, e)
+		return
 	}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+	encoder := l.encoder
+	if encoder == nil {
+		encoder = TextEncoder{}
+	}
 
-	l.println(l.warningLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, v...)
-}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
 
-func (l *Logger) Warnf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+	if err := encoder.Encode(buf, e); err != nil {
+		log.Println("Failed to encode log entry", err)
+		return
 	}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+	var routed [2]io.Writer
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	l.printlnf(l.warningLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, format, v...)
+	// all the writers of the level are written under one lock,
+	// so the lines keep their order in every stream
+	for _, w := range l.route(e.Level, routed[:0]) {
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			log.Println("Failed to write log entry", err)
+		}
+	}
 }
 
-func (l *Logger) WarnWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	if l.warningLog == nil {
-		l.warningLog = log.New(l.output, prefixWarn, log.Ldate|log.Ltime)
+// prints message.
+func (l *Logger) printlnWF(ctx context.Context, level Level, logCat LogCat, status StatusCat, fields *Fields) {
+	if !l.enabled(level, logCat) {
+		return
 	}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+	e := newEntry(ctx, level, logCat, status)
+	// copied so the caller may reuse its map right away
+	e.Fields = make(Fields)
+	if fields != nil {
+		for k, v := range *fields {
+			e.Fields[k] = v
+		}
+	}
+	l.trace(ctx, e)
+	l.write(e)
+}
+
+func (l *Logger) println(ctx context.Context, level Level, logCat LogCat, status StatusCat, v ...interface{}) {
+	if !l.enabled(level, logCat) {
+		return
+	}
 
-	l.printlnWF(l.warningLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, fields)
+	e := newEntry(ctx, level, logCat, status)
+	e.Message = fmt.Sprint(v...)
+	l.trace(ctx, e)
+	l.write(e)
 }
 
-func (l *Logger) Error(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
+func (l *Logger) printlnf(ctx context.Context, level Level, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	if !l.enabled(level, logCat) {
+		return
 	}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+	e := newEntry(ctx, level, logCat, status)
+	e.Message = fmt.Sprintf(format, v...)
+	l.trace(ctx, e)
+	l.write(e)
+}
 
-	l.println(l.errorLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, v...)
+func (l *Logger) Trace(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	l.println(ctx, LevelTrace, logCat, status, v...)
 }
 
-func (l *Logger) Errorf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
-	}
+func (l *Logger) Tracef(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	l.printlnf(ctx, LevelTrace, logCat, status, format, v...)
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+func (l *Logger) TraceWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	l.printlnWF(ctx, LevelTrace, logCat, status, fields)
+}
 
-	l.printlnf(l.errorLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, format, v...)
+func (l *Logger) Debug(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	l.println(ctx, LevelDebug, logCat, status, v...)
 }
 
-func (l *Logger) ErrorWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, prefixError, log.Ldate|log.Ltime)
-	}
+func (l *Logger) Debugf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	l.printlnf(ctx, LevelDebug, logCat, status, format, v...)
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+func (l *Logger) DebugWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	l.printlnWF(ctx, LevelDebug, logCat, status, fields)
+}
 
-	l.printlnWF(l.errorLog, logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, fields)
+func (l *Logger) Info(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	l.println(ctx, LevelInfo, logCat, status, v...)
 }
 
-func (l *Logger) Fatal(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+func (l *Logger) Infof(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	l.printlnf(ctx, LevelInfo, logCat, status, format, v...)
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+func (l *Logger) InfoWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	l.printlnWF(ctx, LevelInfo, logCat, status, fields)
+}
 
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessage(logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, v...))
+func (l *Logger) Printf(status StatusCat, s string, i ...interface{}) {
+	l.printlnf(context.TODO(), LevelInfo, LogCatDebug, status, s, i...)
 }
 
-func (l *Logger) Fatalf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+func (l *Logger) Warn(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	l.println(ctx, LevelWarn, logCat, status, v...)
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+func (l *Logger) Warnf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	l.printlnf(ctx, LevelWarn, logCat, status, format, v...)
+}
 
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessagef(logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, format, v...))
+func (l *Logger) WarnWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	l.printlnWF(ctx, LevelWarn, logCat, status, fields)
+}
+
+func (l *Logger) Error(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	l.println(ctx, LevelError, logCat, status, v...)
+}
+
+func (l *Logger) Errorf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	l.printlnf(ctx, LevelError, logCat, status, format, v...)
+}
+
+func (l *Logger) ErrorWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	l.printlnWF(ctx, LevelError, logCat, status, fields)
+}
+
+func (l *Logger) Fatal(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	l.println(ctx, LevelFatal, logCat, status, v...)
+	l.exitFatal()
+}
+
+func (l *Logger) Fatalf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	l.printlnf(ctx, LevelFatal, logCat, status, format, v...)
+	l.exitFatal()
 }
 
 func (l *Logger) FatalWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	if l.errorLog == nil {
-		l.errorLog = log.New(l.errOutput, "", log.Ldate|log.Ltime)
-	}
+	l.printlnWF(ctx, LevelFatal, logCat, status, fields)
+	l.exitFatal()
+}
 
-	// Extract contextual values
-	contextData, _ := ctx.Value(ContextData).(CtxKeys)
+// Trace prints message at trace level.
+func Trace(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	defaultLogger.println(ctx, LevelTrace, logCat, status, v...)
+}
+
+// Tracef prints message at trace level using the specified format.
+func Tracef(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	defaultLogger.printlnf(ctx, LevelTrace, logCat, status, format, v...)
+}
+
+// TraceWF prints message at trace level using Fields with multiple key=value pairs.
+func TraceWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	defaultLogger.printlnWF(ctx, LevelTrace, logCat, status, fields)
+}
+
+// Debug prints message at debug level.
+func Debug(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
+	defaultLogger.println(ctx, LevelDebug, logCat, status, v...)
+}
+
+// Debugf prints message at debug level using the specified format.
+func Debugf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
+	defaultLogger.printlnf(ctx, LevelDebug, logCat, status, format, v...)
+}
 
-	l.errorLog.SetPrefix(prefixFatal)
-	l.errorLog.Fatal(finalMessageWF(logCat, contextData.StartTime, contextData.TaskName, contextData.UUID, status, fields))
+// DebugWF prints message at debug level using Fields with multiple key=value pairs.
+func DebugWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
+	defaultLogger.printlnWF(ctx, LevelDebug, logCat, status, fields)
 }
 
 // Info prints message with logging level of info
 func Info(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	defaultLogger.Info(ctx, logCat, status, v...)
+	defaultLogger.println(ctx, LevelInfo, logCat, status, v...)
 }
 
 // Infof prints a message using the specified format.
 func Infof(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	defaultLogger.Infof(ctx, logCat, status, format, v...)
+	defaultLogger.printlnf(ctx, LevelInfo, logCat, status, format, v...)
 }
 
 // InfoWF prints message using Fields struct to pass multiple key=value pairs.
 func InfoWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	defaultLogger.InfoWF(ctx, logCat, status, fields)
+	defaultLogger.printlnWF(ctx, LevelInfo, logCat, status, fields)
 }
 
 // Warn prints message with logging level of info
 func Warn(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	defaultLogger.Warn(ctx, logCat, status, v...)
+	defaultLogger.println(ctx, LevelWarn, logCat, status, v...)
 }
 
 // Warnf prints a message using the specified format.
 func Warnf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	defaultLogger.Warnf(ctx, logCat, status, format, v...)
+	defaultLogger.printlnf(ctx, LevelWarn, logCat, status, format, v...)
 }
 
 // WarnWF prints message with fields to use multiple key=value pairs.
 func WarnWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	defaultLogger.WarnWF(ctx, logCat, status, fields)
+	defaultLogger.printlnWF(ctx, LevelWarn, logCat, status, fields)
 }
 
 // Error prints message at error level.
 func Error(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	defaultLogger.Error(ctx, logCat, status, v...)
+	defaultLogger.println(ctx, LevelError, logCat, status, v...)
 }
 
 // Errorf prints message at error level.
 func Errorf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	defaultLogger.Errorf(ctx, logCat, status, format, v...)
+	defaultLogger.printlnf(ctx, LevelError, logCat, status, format, v...)
 }
 
 // ErrorWF prints message at error level using Fields with multiple key=value pairs.
 func ErrorWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	defaultLogger.ErrorWF(ctx, logCat, status, fields)
+	defaultLogger.printlnWF(ctx, LevelError, logCat, status, fields)
 }
 
 // Fatal prints and calls os.exit(1).
 func Fatal(ctx context.Context, logCat LogCat, status StatusCat, v ...interface{}) {
-	defaultLogger.Fatal(ctx, logCat, status, v...)
+	defaultLogger.println(ctx, LevelFatal, logCat, status, v...)
+	defaultLogger.exitFatal()
 }
 
 // Fatalf prints and calls os.exit(1).
 func Fatalf(ctx context.Context, logCat LogCat, status StatusCat, format string, v ...interface{}) {
-	defaultLogger.Fatalf(ctx, logCat, status, format, v...)
+	defaultLogger.printlnf(ctx, LevelFatal, logCat, status, format, v...)
+	defaultLogger.exitFatal()
 }
 
 // FatalWF prints and calls os.exit(1) with multiple key=value pairs.
 func FatalWF(ctx context.Context, logCat LogCat, status StatusCat, fields *Fields) {
-	defaultLogger.FatalWF(ctx, logCat, status, fields)
+	defaultLogger.printlnWF(ctx, LevelFatal, logCat, status, fields)
+	defaultLogger.exitFatal()
 }
@@ -0,0 +1,313 @@
+package apilogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// Entry labels of the streams of a LokiWriter.
+const (
+	LokiLabelLevel  = "level"
+	LokiLabelCode   = "code"
+	LokiLabelType   = "type"
+	LokiLabelStatus = "status"
+	LokiLabelTask   = "taskName"
+)
+
+// lokiPushPath is the path of the push API.
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiConfig configures a LokiWriter.
+type LokiConfig struct {
+	// URL of Loki, the push API path is added when
+	// it has none, e.g. http://loki:3100.
+	URL string
+
+	// Labels are the entry labels the streams are made of, among
+	// the LokiLabel constants, level and type when nil. Values
+	// with a high cardinality, like the uuid, belong in the line.
+	Labels []string
+
+	// StaticLabels are added to every stream, e.g. service. A
+	// stream left without any label is sent as job="apilogger",
+	// as Loki rejects the streams without labels.
+	StaticLabels map[string]string
+
+	// TenantID is sent as X-Scope-OrgID, for multi-tenant Loki.
+	TenantID string
+
+	// Header is added to every request, e.g. for authentication.
+	Header http.Header
+
+	// Protobuf pushes snappy compressed protocol buffers
+	// instead of JSON.
+	Protobuf bool
+
+	// Client sends the requests, a client with a 10s
+	// timeout when nil.
+	Client *http.Client
+
+	// Batch sets the size of the batches and their retries.
+	Batch BatchConfig
+}
+
+// LokiWriter is a sink writer pushing entries to Grafana Loki. Entries
+// are grouped in streams by their labels, the line being the entry as
+// encoded by the sink, without its trailing newline. Batches are sent
+// in the background and retried like those of an HTTPWriter.
+type LokiWriter struct {
+	cfg     LokiConfig
+	url     string
+	batcher *batcher
+}
+
+// lokiLine is an entry buffered by a LokiWriter.
+type lokiLine struct {
+	// selector identifies the stream, e.g. {level="info"}
+	selector string
+	labels   map[string]string
+	time     time.Time
+	line     string
+}
+
+// NewLokiWriter returns a LokiWriter for the config.
+func NewLokiWriter(cfg LokiConfig) (*LokiWriter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("apilogger: invalid loki url " + strconv.Quote(cfg.URL))
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+
+	if cfg.Labels == nil {
+		cfg.Labels = []string{LokiLabelLevel, LokiLabelType}
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	w := &LokiWriter{cfg: cfg, url: u.String()}
+	w.batcher = newBatcher(cfg.Batch, w.send)
+	return w, nil
+}
+
+// WriteEntry implements EntryWriter.
+func (w *LokiWriter) WriteEntry(e *Entry, p []byte) error {
+	labels := make(map[string]string, len(w.cfg.Labels)+len(w.cfg.StaticLabels))
+	for k, v := range w.cfg.StaticLabels {
+		labels[k] = v
+	}
+	for _, name := range w.cfg.Labels {
+		switch name {
+		case LokiLabelLevel:
+			labels[name] = strings.ToLower(e.Level.String())
+		case LokiLabelCode:
+			labels[name] = e.LogCat.Code
+		case LokiLabelType:
+			labels[name] = e.LogCat.Type
+		case LokiLabelStatus:
+			labels[name] = e.Status.Type
+		case LokiLabelTask:
+			labels[name] = e.Context.TaskName
+		}
+	}
+
+	return w.add(labels, e.Time, p)
+}
+
+// Write implements io.Writer, pushing p in
+// the stream of the static labels.
+func (w *LokiWriter) Write(p []byte) (int, error) {
+	if err := w.add(w.cfg.StaticLabels, time.Now(), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *LokiWriter) add(labels map[string]string, t time.Time, p []byte) error {
+	labels = lokiLabels(labels)
+	l := lokiLine{
+		selector: lokiSelector(labels),
+		labels:   labels,
+		time:     t,
+		line:     strings.TrimSuffix(string(p), "\n"),
+	}
+	return w.batcher.add(l, len(l.selector)+len(l.line))
+}
+
+// Flush sends the current batch and waits until
+// every batch written so far is sent or dropped.
+func (w *LokiWriter) Flush() error {
+	w.batcher.flush()
+	return nil
+}
+
+// Close sends the current batch and stops the writer.
+func (w *LokiWriter) Close() error {
+	return w.batcher.close()
+}
+
+// lokiStream is a stream of a push request.
+type lokiStream struct {
+	selector string
+	labels   map[string]string
+	lines    []lokiLine
+}
+
+// send pushes the batch once.
+func (w *LokiWriter) send(items []batchItem) error {
+	// streams keep the order of their first entry
+	var streams []*lokiStream
+	index := make(map[string]*lokiStream)
+	for _, item := range items {
+		l := item.value.(lokiLine)
+		s, ok := index[l.selector]
+		if !ok {
+			s = &lokiStream{selector: l.selector, labels: l.labels}
+			index[l.selector] = s
+			streams = append(streams, s)
+		}
+		s.lines = append(s.lines, l)
+	}
+
+	var body []byte
+	contentType := "application/json"
+	if w.cfg.Protobuf {
+		body = snappy.Encode(nil, lokiProtobuf(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		var err error
+		if body, err = lokiJSON(streams); err != nil {
+			return permanent(err)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	for k, vs := range w.cfg.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", w.cfg.TenantID)
+	}
+
+	_, err = doBatchRequest(w.cfg.Client, req)
+	return err
+}
+
+// lokiDefaultJob is the job label of the streams left without labels.
+const lokiDefaultJob = "apilogger"
+
+// lokiLabels returns the non empty labels, with their
+// names made valid label names, or the default job.
+func lokiLabels(labels map[string]string) map[string]string {
+	valid := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if value != "" {
+			valid[lokiLabelName(name)] = value
+		}
+	}
+	if len(valid) == 0 {
+		valid["job"] = lokiDefaultJob
+	}
+	return valid
+}
+
+// lokiSelector returns the labels in the stream
+// selector syntax, sorted by name.
+func lokiSelector(labels map[string]string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range sortedLabels(labels) {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// sortedLabels returns the names of the labels in lexical order.
+func sortedLabels(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lokiLabelName replaces the characters not allowed in label names.
+func lokiLabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lokiJSON returns the JSON push request of the streams.
+func lokiJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, s := range streams {
+		js := jsonStream{Stream: s.labels}
+		for _, l := range s.lines {
+			js.Values = append(js.Values, [2]string{
+				strconv.FormatInt(l.time.UnixNano(), 10), l.line,
+			})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// lokiProtobuf returns the logproto.PushRequest of the streams.
+func lokiProtobuf(streams []*lokiStream) []byte {
+	var req protoBuffer
+	for _, s := range streams {
+		// PushRequest.streams
+		req.messageField(1, func(stream *protoBuffer) {
+			stream.stringField(1, s.selector)
+			for _, l := range s.lines {
+				// StreamAdapter.entries
+				stream.messageField(2, func(entry *protoBuffer) {
+					entry.messageField(1, func(ts *protoBuffer) {
+						ts.int64Field(1, l.time.Unix())
+						ts.int64Field(2, int64(l.time.Nanosecond()))
+					})
+					entry.stringField(2, l.line)
+				})
+			}
+		})
+	}
+	return req.b
+}
@@ -0,0 +1,276 @@
+package apilogger
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// lokiEntry is an entry received by fakeLoki.
+type lokiEntry struct {
+	stream string
+	time   time.Time
+	line   string
+}
+
+// fakeLoki is a stub Loki push endpoint decoding both the
+// JSON and the snappy compressed protobuf requests.
+type fakeLoki struct {
+	mu      sync.Mutex
+	entries []lokiEntry
+	headers []http.Header
+	// failures is the number of requests to respond 503 to
+	failures int32
+	hits     int32
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != lokiPushPath {
+		http.NotFound(w, r)
+		return
+	}
+	if atomic.AddInt32(&f.hits, 1) <= atomic.LoadInt32(&f.failures) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var entries []lokiEntry
+	var err error
+	if r.Header.Get("Content-Type") == "application/x-protobuf" {
+		entries, err = decodeLokiProtobuf(body)
+	} else {
+		entries, err = f.decodeJSON(body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.entries = append(f.entries, entries...)
+	f.headers = append(f.headers, r.Header)
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeLoki) decodeJSON(body []byte) ([]lokiEntry, error) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	var entries []lokiEntry
+	for _, s := range req.Streams {
+		for _, v := range s.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, lokiEntry{lokiSelector(s.Stream), time.Unix(0, ns), v[1]})
+		}
+	}
+	return entries, nil
+}
+
+// protoFields returns the fields of a protobuf message, the
+// varints and fixed values as uint64 and the others as []byte.
+func protoFields(b []byte) (map[int][]interface{}, error) {
+	fields := make(map[int][]interface{})
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, strconv.ErrSyntax
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+
+		switch tag & 7 {
+		case protoFixed64:
+			if len(b) < 8 {
+				return nil, strconv.ErrSyntax
+			}
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+			continue
+		case protoFixed32:
+			if len(b) < 4 {
+				return nil, strconv.ErrSyntax
+			}
+			fields[field] = append(fields[field], uint64(binary.LittleEndian.Uint32(b)))
+			b = b[4:]
+			continue
+		}
+
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, strconv.ErrSyntax
+		}
+		b = b[n:]
+
+		switch tag & 7 {
+		case protoVarint:
+			fields[field] = append(fields[field], v)
+		case protoBytes:
+			if uint64(len(b)) < v {
+				return nil, strconv.ErrSyntax
+			}
+			fields[field] = append(fields[field], b[:v])
+			b = b[v:]
+		default:
+			return nil, strconv.ErrSyntax
+		}
+	}
+	return fields, nil
+}
+
+func decodeLokiProtobuf(body []byte) ([]lokiEntry, error) {
+	b, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []lokiEntry
+	for _, s := range req[1] {
+		stream, err := protoFields(s.([]byte))
+		if err != nil {
+			return nil, err
+		}
+		selector := string(stream[1][0].([]byte))
+		for _, e := range stream[2] {
+			entry, err := protoFields(e.([]byte))
+			if err != nil {
+				return nil, err
+			}
+			ts, err := protoFields(entry[1][0].([]byte))
+			if err != nil {
+				return nil, err
+			}
+			var sec, nsec uint64
+			if len(ts[1]) > 0 {
+				sec = ts[1][0].(uint64)
+			}
+			if len(ts[2]) > 0 {
+				nsec = ts[2][0].(uint64)
+			}
+			entries = append(entries, lokiEntry{
+				selector, time.Unix(int64(sec), int64(nsec)), string(entry[2][0].([]byte)),
+			})
+		}
+	}
+	return entries, nil
+}
+
+func (f *fakeLoki) received() []lokiEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]lokiEntry(nil), f.entries...)
+}
+
+func lokiContext() context.Context {
+	return context.WithValue(context.Background(), ContextData, CtxKeys{
+		TaskName: "UpdatePassword",
+		UUID:     "12345zw",
+	})
+}
+
+func TestLokiWriter(t *testing.T) {
+	for _, protobuf := range []bool{false, true} {
+		f := &fakeLoki{}
+		server := httptest.NewServer(f)
+
+		w, err := NewLokiWriter(LokiConfig{
+			URL:          server.URL,
+			Labels:       []string{LokiLabelLevel, LokiLabelType, LokiLabelTask},
+			StaticLabels: map[string]string{"service": "billing", "empty": ""},
+			TenantID:     "team-a",
+			Protobuf:     protobuf,
+			Batch:        fastRetries,
+		})
+		assertion.NoError(t, err)
+
+		logger := New(WithSink(Sink{Name: "loki", Writer: w, Encoder: LogfmtEncoder{}}))
+		ctx := lokiContext()
+		before := time.Now()
+		logger.Info(ctx, LogCatCSV, StatusCatPassed, "first")
+		logger.Error(ctx, LogCatSMTP, StatusCatFailed, "second")
+		logger.Info(context.Background(), LogCatCSV, StatusCatPassed, "third")
+		assertion.NoError(t, logger.Sync())
+		assertion.NoError(t, w.Close())
+		server.Close()
+
+		assert := assertion.New(t)
+		entries := f.received()
+		if !assert.Len(entries, 3, "protobuf %t", protobuf) {
+			continue
+		}
+
+		assert.Equal(`{level="info", service="billing", taskName="UpdatePassword", type="csv"}`, entries[0].stream)
+		assert.Equal(`{level="error", service="billing", taskName="UpdatePassword", type="smtp"}`, entries[1].stream)
+		assert.Equal(`{level="info", service="billing", type="csv"}`, entries[2].stream)
+
+		// the uuid stays in the line, not in the labels
+		assert.Contains(entries[0].line, `uuid=12345zw`)
+		assert.Contains(entries[0].line, `message=first`)
+		assert.NotContains(entries[0].line, "\n")
+		assert.False(entries[0].time.Before(before.Truncate(time.Second)))
+		assert.Equal("team-a", f.headers[0].Get("X-Scope-OrgID"))
+	}
+}
+
+func TestLokiWriterRetries(t *testing.T) {
+	f := &fakeLoki{failures: 2}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	w, err := NewLokiWriter(LokiConfig{URL: server.URL + "/", Batch: fastRetries})
+	assertion.NoError(t, err)
+
+	_, err = w.Write([]byte("plain\n"))
+	assertion.NoError(t, err)
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	assert.Equal(int32(3), atomic.LoadInt32(&f.hits))
+	if assert.Len(f.received(), 1) {
+		assert.Equal(`{job="apilogger"}`, f.received()[0].stream)
+		assert.Equal("plain", f.received()[0].line)
+	}
+
+	_, err = NewLokiWriter(LokiConfig{URL: "loki:3100"})
+	assert.Error(err)
+}
+
+func TestLokiSelector(t *testing.T) {
+	labels := lokiLabels(map[string]string{
+		"service":   `api "v2"`,
+		"9lives":    "cat",
+		"host.name": "web-1",
+		"empty":     "",
+	})
+	assertion.Equal(t, `{_lives="cat", host_name="web-1", service="api \"v2\""}`, lokiSelector(labels))
+
+	// Loki rejects the streams without labels
+	assertion.Equal(t, `{job="apilogger"}`, lokiSelector(lokiLabels(nil)))
+	assertion.Equal(t, `{job="apilogger"}`, lokiSelector(lokiLabels(map[string]string{"type": ""})))
+}
@@ -1,6 +1,7 @@
 package apilogger
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"strings"
@@ -32,30 +33,54 @@ func TestGenerateConfig(t *testing.T) {
 }
 
 func TestFuncName(t *testing.T) {
-	expected := "v2.TestFuncName"
+	expected := "v3.TestFuncName"
 
 	// mimics call stack depth
-	func1 := func() string { return funcName() }
+	func1 := func() string { return caller().Function }
 	func2 := func() string { return func1() }
 	func3 := func() string { return func2() }
-	func4 := func() string { return func3() }
 
-	output := func4()
+	output := func3()
 
-	assertion.New(t).Equal(output, expected)
+	assertion.New(t).Equal(expected, output)
 }
 
-func TestBaseMessage(t *testing.T) {
+func TestLocation(t *testing.T) {
 	// mimics call stack depth
-	func1 := func() string {
-		return baseMessage(LogCatDebug, time.Now(), "UpdatePassword", "12345zw", StatusCatPending)
+	func1 := func() Caller { return caller() }
+	func2 := func() Caller { return func1() }
+	func3 := func() Caller { return func2() }
+
+	output := func3()
+
+	assertion.New(t).True(strings.HasPrefix(output.Location(), "main_test.go:"), output.Location())
+}
+
+// textMessage encodes an entry the way the default Logger does.
+func textMessage(t *testing.T, e *Entry) string {
+	var buf bytes.Buffer
+	if err := (TextEncoder{}).Encode(&buf, e); err != nil {
+		t.Fatal(err)
 	}
-	func2 := func() string { return func1() }
-	func3 := func() string { return func2() }
-	func4 := func() string { return func3() }
-	func5 := func() string { return func4() }
+	return buf.String()
+}
+
+func testEntry(logCat LogCat) *Entry {
+	return &Entry{
+		Level: LevelInfo,
+		Time:  time.Now(),
+		Context: CtxKeys{
+			TaskName:  "UpdatePassword",
+			UUID:      "12345zw",
+			StartTime: time.Now(),
+		},
+		LogCat: logCat,
+		Status: StatusCatPending,
+	}
+}
 
-	output := func5()
+func TestBaseMessage(t *testing.T) {
+	output := textMessage(t, testEntry(LogCatDebug))
 
 	if !strings.Contains(output, "taskName") {
 		t.Errorf("Output insufficient - [%s]", output)
@@ -64,27 +89,23 @@ func TestBaseMessage(t *testing.T) {
 
 func TestFinalMessage(t *testing.T) {
 	logCat := LogCatStartUp
-	output := finalMessage(logCat, time.Now(), "UpdatePassword", "12345zw", StatusCatPending, "hello test")
+	e := testEntry(logCat)
+	e.Message = "hello test"
+	output := textMessage(t, e)
 	assert := assertion.New(t)
 
+	assert.True(strings.HasPrefix(output, "INFO "))
+	assert.True(strings.HasSuffix(output, "\n"))
 	assert.Contains(output, "hello test")
 	assert.Contains(output, " code=\""+logCat.Code+"\"")
 	assert.Contains(output, " type=\""+logCat.Type+"\"")
 }
 
-func TestFinalMessagef(t *testing.T) {
-	logCat := LogCatStartUp
-	output := finalMessagef(logCat, time.Now(), "UpdatePassword", "12345zw", StatusCatPending, "%s", "hello test")
-	assert := assertion.New(t)
-
-	assert.Contains(output, " message=\"hello test\"")
-	assert.Contains(output, " code=\""+logCat.Code+"\"")
-	assert.Contains(output, " type=\""+logCat.Type+"\"")
-}
-
 func TestFinalMessageWF(t *testing.T) {
 	logCat := LogCatStartUp
-	output := finalMessageWF(logCat, time.Now(), "UpdatePassword", "12345zw", StatusCatPending, &Fields{"message": "hello test"})
+	e := testEntry(logCat)
+	e.Fields = Fields{"message": "hello test"}
+	output := textMessage(t, e)
 	assert := assertion.New(t)
 
 	assert.Contains(output, " message=\"hello test\"")
@@ -0,0 +1,274 @@
+package apilogger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The msgpack functions append MessagePack values to b, enough
+// to serialize the entries of the Fluent forward protocol.
+
+func msgpackNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func msgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func msgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<7:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, 0xcd, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		b = append(b, 0xce)
+		return msgpackUint32(b, uint32(v))
+	default:
+		b = append(b, 0xcf, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], v)
+		return b
+	}
+}
+
+func msgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return msgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return append(b, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		b = append(b, 0xd2)
+		return msgpackUint32(b, uint32(v))
+	default:
+		b = append(b, 0xd3, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(v))
+		return b
+	}
+}
+
+func msgpackUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func msgpackFloat(b []byte, v float64) []byte {
+	b = append(b, 0xcb, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+	return b
+}
+
+func msgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb)
+		b = msgpackUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackBin(b []byte, v []byte) []byte {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xc6)
+		b = msgpackUint32(b, uint32(n))
+	}
+	return append(b, v...)
+}
+
+func msgpackArray(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdd)
+		return msgpackUint32(b, uint32(n))
+	}
+}
+
+func msgpackMap(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdf)
+		return msgpackUint32(b, uint32(n))
+	}
+}
+
+// msgpackEventTime appends t as the EventTime extension
+// of the Fluent forward protocol.
+func msgpackEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = msgpackUint32(b, uint32(t.Unix()))
+	return msgpackUint32(b, uint32(t.Nanosecond()))
+}
+
+// msgpackValue appends v. Errors are written as their message, times
+// in RFC 3339 and other types as they would be marshalled to JSON,
+// or their default string representation.
+func msgpackValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return msgpackNil(b)
+	case bool:
+		return msgpackBool(b, v)
+	case int:
+		return msgpackInt(b, int64(v))
+	case int8:
+		return msgpackInt(b, int64(v))
+	case int16:
+		return msgpackInt(b, int64(v))
+	case int32:
+		return msgpackInt(b, int64(v))
+	case int64:
+		return msgpackInt(b, v)
+	case uint:
+		return msgpackUint(b, uint64(v))
+	case uint8:
+		return msgpackUint(b, uint64(v))
+	case uint16:
+		return msgpackUint(b, uint64(v))
+	case uint32:
+		return msgpackUint(b, uint64(v))
+	case uint64:
+		return msgpackUint(b, v)
+	case float32:
+		return msgpackFloat(b, float64(v))
+	case float64:
+		return msgpackFloat(b, v)
+	case string:
+		return msgpackString(b, v)
+	case []byte:
+		return msgpackBin(b, v)
+	case error:
+		return msgpackString(b, v.Error())
+	case time.Time:
+		return msgpackString(b, v.Format(time.RFC3339Nano))
+	case time.Duration:
+		return msgpackString(b, v.String())
+	case []interface{}:
+		b = msgpackArray(b, len(v))
+		for _, e := range v {
+			b = msgpackValue(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		b = msgpackMap(b, len(v))
+		for _, k := range sortedKeys(v) {
+			b = msgpackString(b, k)
+			b = msgpackValue(b, v[k])
+		}
+		return b
+	case Fields:
+		return msgpackValue(b, map[string]interface{}(v))
+	}
+
+	// other types go through their JSON representation
+	data, err := json.Marshal(v)
+	if err != nil {
+		return msgpackString(b, fmt.Sprint(v))
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return msgpackString(b, fmt.Sprint(v))
+	}
+	return msgpackValue(b, decoded)
+}
+
+// The readMsgpack functions read the few MessagePack values
+// received from a forward server.
+
+// errMsgpackType is returned when a value of an unexpected type is read.
+var errMsgpackType = errors.New("apilogger: unexpected msgpack type")
+
+func readMsgpackMapHeader(r *bufio.Reader) (int, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		n, err := readBigEndian(r, 2)
+		return int(n), err
+	case c == 0xdf:
+		n, err := readBigEndian(r, 4)
+		return int(n), err
+	}
+	return 0, errMsgpackType
+}
+
+func readMsgpackString(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var n uint64
+	switch {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = readBigEndian(r, 1)
+	case c == 0xda, c == 0xc5:
+		n, err = readBigEndian(r, 2)
+	case c == 0xdb, c == 0xc6:
+		n, err = readBigEndian(r, 4)
+	default:
+		return "", errMsgpackType
+	}
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func readBigEndian(r *bufio.Reader, size int) (uint64, error) {
+	var n uint64
+	for i := 0; i < size; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
@@ -0,0 +1,187 @@
+package apilogger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// decodeMsgpack reads a MessagePack value, integers as int64,
+// EventTime extensions as time.Time and bin values as []byte.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c < 0x80:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(r, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(r, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		b, err := readN(r, int(c&0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readBigEndian(r, 1<<(c-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readN(r, int(n))
+	case 0xcb:
+		n, err := readBigEndian(r, 8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readBigEndian(r, 1<<(c-0xcc))
+		return int64(n), err
+	case 0xd0:
+		n, err := readBigEndian(r, 1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := readBigEndian(r, 2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := readBigEndian(r, 4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := readBigEndian(r, 8)
+		return int64(n), err
+	case 0xd7:
+		b, err := readN(r, 9)
+		if err != nil || b[0] != 0 {
+			return nil, errMsgpackType
+		}
+		sec := binary.BigEndian.Uint32(b[1:5])
+		nsec := binary.BigEndian.Uint32(b[5:])
+		return time.Unix(int64(sec), int64(nsec)), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := readBigEndian(r, 1<<(c-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := readN(r, int(n))
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := readBigEndian(r, 2<<(c-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackArray(r, int(n))
+	case 0xde, 0xdf:
+		n, err := readBigEndian(r, 2<<(c-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackMap(r, int(n))
+	}
+	return nil, fmt.Errorf("unsupported msgpack type %#x", c)
+}
+
+func decodeMsgpackArray(r *bufio.Reader, n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	for i := range values {
+		var err error
+		if values[i], err = decodeMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func decodeMsgpackMap(r *bufio.Reader, n int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("msgpack map key is not a string")
+		}
+		if m[key], err = decodeMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func readN(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func TestMsgpackValues(t *testing.T) {
+	type point struct{ X, Y int }
+	at := time.Date(2024, 3, 1, 10, 30, 0, 5, time.UTC)
+	long := strings.Repeat("a", 300)
+
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{5, int64(5)},
+		{-5, int64(-5)},
+		{-100, int64(-100)},
+		{-1000, int64(-1000)},
+		{-100000, int64(-100000)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{200, int64(200)},
+		{70000, int64(70000)},
+		{uint64(1) << 40, int64(1) << 40},
+		{1.5, 1.5},
+		{float32(0.5), 0.5},
+		{"short", "short"},
+		{long, long},
+		{[]byte{1, 2}, []byte{1, 2}},
+		{errors.New("failed"), "failed"},
+		{at, "2024-03-01T10:30:00.000000005Z"},
+		{[]interface{}{1, "a"}, []interface{}{int64(1), "a"}},
+		{Fields{"b": 1, "a": nil}, map[string]interface{}{"a": nil, "b": int64(1)}},
+		{point{1, 2}, map[string]interface{}{"X": 1.0, "Y": 2.0}},
+		{make(chan int), "<chan>"},
+	}
+
+	for _, test := range tests {
+		b := msgpackValue(nil, test.value)
+		got, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(b)))
+		assertion.NoError(t, err, "%#v", test.value)
+		if s, ok := test.want.(string); ok && s == "<chan>" {
+			assertion.IsType(t, "", got)
+			continue
+		}
+		assertion.Equal(t, test.want, got, "%#v", test.value)
+	}
+}
+
+func TestMsgpackEventTime(t *testing.T) {
+	at := time.Unix(1700000000, 123456789)
+	got, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(msgpackEventTime(nil, at))))
+	assertion.NoError(t, err)
+	assertion.True(t, at.Equal(got.(time.Time)))
+}
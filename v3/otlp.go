@@ -0,0 +1,481 @@
+package apilogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// otlpLogsPath is the path of the OTLP/HTTP logs endpoint.
+const otlpLogsPath = "/v1/logs"
+
+// otlpScope is the instrumentation scope of the records.
+const otlpScope = "github.com/sanservices/apilogger/v3"
+
+// OTLPConfig configures an OTLPWriter.
+type OTLPConfig struct {
+	// URL of the collector, the logs endpoint path is added
+	// when it has none, e.g. http://otel-collector:4318.
+	URL string
+
+	// JSON exports JSON encoded requests instead of protobuf.
+	JSON bool
+
+	// ServiceName is the service.name resource attribute, the
+	// name of the executable when empty. Resource holds the other
+	// resource attributes, e.g. service.version or
+	// deployment.environment.
+	ServiceName string
+	Resource    map[string]string
+
+	// Header is added to every request, e.g. for authentication.
+	Header http.Header
+
+	// Gzip compresses the requests.
+	Gzip bool
+
+	// Client sends the requests, a client with a 10s
+	// timeout when nil.
+	Client *http.Client
+
+	// Batch sets the size of the batches and their retries.
+	Batch BatchConfig
+}
+
+// OTLPWriter is a sink writer exporting entries as OpenTelemetry log
+// records over OTLP/HTTP. The level is mapped to a severity number,
+// the message is the body, the code, type, status, uuid and taskName
+// are apilogger.* attributes, the fields attributes of their own name,
+// and the caller is reported with the code.* semantic attributes.
+// Records of entries logged in a span carry its trace and span ids.
+// Batches are retried like those of an HTTPWriter.
+type OTLPWriter struct {
+	cfg      OTLPConfig
+	url      string
+	resource []jsonField
+	batcher  *batcher
+}
+
+// otlpRecord is an entry buffered by an OTLPWriter.
+type otlpRecord struct {
+	time         time.Time
+	observed     time.Time
+	severity     int
+	severityText string
+	body         string
+	attributes   []jsonField
+	trace        TraceContext
+}
+
+// NewOTLPWriter returns an OTLPWriter for the config.
+func NewOTLPWriter(cfg OTLPConfig) (*OTLPWriter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("apilogger: invalid otlp url " + strconv.Quote(cfg.URL))
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpLogsPath
+	}
+
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = filepath.Base(os.Args[0])
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	w := &OTLPWriter{cfg: cfg, url: u.String()}
+	w.resource = append(w.resource, jsonField{"service.name", cfg.ServiceName})
+	for _, k := range sortedLabels(cfg.Resource) {
+		if k != "service.name" {
+			w.resource = append(w.resource, jsonField{k, cfg.Resource[k]})
+		}
+	}
+
+	w.batcher = newBatcher(cfg.Batch, w.send)
+	return w, nil
+}
+
+// otlpSeverity returns the severity number of the level.
+func otlpSeverity(level Level) int {
+	switch level {
+	case LevelTrace:
+		return 1
+	case LevelDebug:
+		return 5
+	case LevelInfo:
+		return 9
+	case LevelWarn:
+		return 13
+	case LevelError:
+		return 17
+	case LevelFatal:
+		return 21
+	default:
+		return 0
+	}
+}
+
+// WriteEntry implements EntryWriter.
+func (w *OTLPWriter) WriteEntry(e *Entry, p []byte) error {
+	attributes := []jsonField{
+		{"apilogger.code", e.LogCat.Code},
+		{"apilogger.type", e.LogCat.Type},
+		{"apilogger.status", e.Status.Type},
+		{"apilogger.uuid", e.Context.UUID},
+		{"apilogger.taskName", e.Context.TaskName},
+		{"code.filepath", e.Caller.File},
+		{"code.lineno", int64(e.Caller.Line)},
+		{"code.function", e.Caller.Function},
+	}
+
+	reserved := make(map[string]bool, len(attributes))
+	for _, a := range attributes {
+		reserved[a.key] = true
+	}
+
+	r := &otlpRecord{
+		time:         e.Time,
+		observed:     time.Now(),
+		severity:     otlpSeverity(e.Level),
+		severityText: e.Level.String(),
+		body:         e.Message,
+		trace:        e.Trace,
+	}
+	for _, a := range attributes {
+		if a.value != "" && a.value != int64(0) {
+			r.attributes = append(r.attributes, a)
+		}
+	}
+	for _, k := range sortedKeys(e.Fields) {
+		r.attributes = append(r.attributes, jsonField{fieldKey(k, reserved), otlpValue(e.Fields[k])})
+	}
+
+	return w.add(r)
+}
+
+// Write implements io.Writer, exporting p as the
+// body of a record of informational severity.
+func (w *OTLPWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	r := &otlpRecord{
+		time:         now,
+		observed:     now,
+		severity:     otlpSeverity(LevelInfo),
+		severityText: LevelInfo.String(),
+		body:         string(bytes.TrimSuffix(p, []byte("\n"))),
+	}
+	if err := w.add(r); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *OTLPWriter) add(r *otlpRecord) error {
+	size := len(r.body) + 64
+	for _, a := range r.attributes {
+		size += len(a.key) + 16
+		if s, ok := a.value.(string); ok {
+			size += len(s)
+		}
+	}
+	return w.batcher.add(r, size)
+}
+
+// Flush sends the current batch and waits until
+// every batch written so far is sent or dropped.
+func (w *OTLPWriter) Flush() error {
+	w.batcher.flush()
+	return nil
+}
+
+// Close sends the current batch and stops the writer.
+func (w *OTLPWriter) Close() error {
+	return w.batcher.close()
+}
+
+// send exports the batch once.
+func (w *OTLPWriter) send(items []batchItem) error {
+	records := make([]*otlpRecord, len(items))
+	for i, item := range items {
+		records[i] = item.value.(*otlpRecord)
+	}
+
+	var body []byte
+	contentType := "application/x-protobuf"
+	if w.cfg.JSON {
+		var err error
+		if body, err = w.json(records); err != nil {
+			return permanent(err)
+		}
+		contentType = "application/json"
+	} else {
+		body = w.protobuf(records)
+	}
+
+	if w.cfg.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return permanent(err)
+		}
+		if err := zw.Close(); err != nil {
+			return permanent(err)
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	for k, vs := range w.cfg.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	_, err = doBatchRequest(w.cfg.Client, req)
+	return err
+}
+
+// protobuf returns the ExportLogsServiceRequest of the records.
+func (w *OTLPWriter) protobuf(records []*otlpRecord) []byte {
+	var req protoBuffer
+	// ExportLogsServiceRequest.resource_logs
+	req.messageField(1, func(rl *protoBuffer) {
+		// ResourceLogs.resource
+		rl.messageField(1, func(res *protoBuffer) {
+			for _, a := range w.resource {
+				res.messageField(1, func(kv *protoBuffer) { protoKeyValue(kv, a) })
+			}
+		})
+		// ResourceLogs.scope_logs
+		rl.messageField(2, func(sl *protoBuffer) {
+			sl.messageField(1, func(scope *protoBuffer) {
+				scope.stringField(1, otlpScope)
+			})
+			for _, r := range records {
+				// ScopeLogs.log_records
+				sl.messageField(2, func(lr *protoBuffer) {
+					lr.fixed64Field(1, uint64(r.time.UnixNano()))
+					lr.uint64Field(2, uint64(r.severity))
+					lr.stringField(3, r.severityText)
+					if r.body != "" {
+						lr.messageField(5, func(v *protoBuffer) { protoAnyValue(v, r.body) })
+					}
+					for _, a := range r.attributes {
+						lr.messageField(6, func(kv *protoBuffer) { protoKeyValue(kv, a) })
+					}
+					if r.trace.IsValid() {
+						lr.fixed32Field(8, uint32(r.trace.Flags))
+						lr.bytesField(9, r.trace.TraceID[:])
+						lr.bytesField(10, r.trace.SpanID[:])
+					}
+					lr.fixed64Field(11, uint64(r.observed.UnixNano()))
+				})
+			}
+		})
+	})
+	return req.b
+}
+
+// protoKeyValue writes the fields of a KeyValue.
+func protoKeyValue(kv *protoBuffer, a jsonField) {
+	kv.stringField(1, a.key)
+	kv.messageField(2, func(v *protoBuffer) { protoAnyValue(v, a.value) })
+}
+
+// protoAnyValue writes the fields of an AnyValue, v being
+// a value returned by otlpValue. Unlike other fields, zero
+// values are written as they select the type of the value.
+func protoAnyValue(p *protoBuffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		p.tag(1, protoBytes)
+		p.varint(uint64(len(v)))
+		p.b = append(p.b, v...)
+	case bool:
+		p.tag(2, protoVarint)
+		if v {
+			p.varint(1)
+		} else {
+			p.varint(0)
+		}
+	case int64:
+		p.tag(3, protoVarint)
+		p.varint(uint64(v))
+	case float64:
+		p.tag(4, protoFixed64)
+		p.fixed64(math.Float64bits(v))
+	case []interface{}:
+		// ArrayValue.values
+		p.messageField(5, func(array *protoBuffer) {
+			for _, e := range v {
+				array.messageField(1, func(value *protoBuffer) { protoAnyValue(value, e) })
+			}
+		})
+	case map[string]interface{}:
+		// KeyValueList.values
+		p.messageField(6, func(list *protoBuffer) {
+			for _, k := range sortedKeys(v) {
+				list.messageField(1, func(kv *protoBuffer) { protoKeyValue(kv, jsonField{k, v[k]}) })
+			}
+		})
+	}
+}
+
+// json returns the JSON encoded ExportLogsServiceRequest of the records.
+func (w *OTLPWriter) json(records []*otlpRecord) ([]byte, error) {
+	logRecords := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		lr := map[string]interface{}{
+			"timeUnixNano":         strconv.FormatInt(r.time.UnixNano(), 10),
+			"observedTimeUnixNano": strconv.FormatInt(r.observed.UnixNano(), 10),
+			"severityNumber":       r.severity,
+			"severityText":         r.severityText,
+			"attributes":           jsonKeyValues(r.attributes),
+		}
+		if r.body != "" {
+			lr["body"] = jsonAnyValue(r.body)
+		}
+		if r.trace.IsValid() {
+			// ids are hex encoded, unlike other bytes fields
+			lr["traceId"] = r.trace.TraceIDString()
+			lr["spanId"] = r.trace.SpanIDString()
+			lr["flags"] = r.trace.Flags
+		}
+		logRecords[i] = lr
+	}
+
+	req := map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": jsonKeyValues(w.resource)},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]interface{}{"name": otlpScope},
+				"logRecords": logRecords,
+			}},
+		}},
+	}
+	return json.Marshal(req)
+}
+
+func jsonKeyValues(attributes []jsonField) []interface{} {
+	kvs := make([]interface{}, len(attributes))
+	for i, a := range attributes {
+		kvs[i] = map[string]interface{}{"key": a.key, "value": jsonAnyValue(a.value)}
+	}
+	return kvs
+}
+
+// jsonAnyValue returns the JSON AnyValue of v, a value returned by
+// otlpValue. 64 bit integers are strings, as in the protobuf JSON mapping.
+func jsonAnyValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = jsonAnyValue(e)
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case map[string]interface{}:
+		var kvs []jsonField
+		for _, k := range sortedKeys(v) {
+			kvs = append(kvs, jsonField{k, v[k]})
+		}
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": jsonKeyValues(kvs)}}
+	}
+	return map[string]interface{}{}
+}
+
+// otlpValue returns v as a string, bool, int64, float64, []interface{}
+// or map[string]interface{}. Errors are their message, times RFC 3339,
+// unsigned integers too large for an int64 their decimal string
+// and other types are converted through their JSON representation, or
+// their default string representation.
+func otlpValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string, bool, int64, float64:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return otlpUint(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return otlpUint(v)
+	case float32:
+		return float64(v)
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = otlpValue(e)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			values[k] = otlpValue(e)
+		}
+		return values
+	case Fields:
+		return otlpValue(map[string]interface{}(v))
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Sprint(v)
+	}
+	return otlpValue(decoded)
+}
+
+// otlpUint returns v as an int64, or as its decimal string
+// when it does not fit in the signed integers of OTLP.
+func otlpUint(v uint64) interface{} {
+	if v > math.MaxInt64 {
+		return strconv.FormatUint(v, 10)
+	}
+	return int64(v)
+}
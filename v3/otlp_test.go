@@ -0,0 +1,426 @@
+package apilogger
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// otlpRecv is a log record received by fakeCollector, with its
+// attributes as strings, bools, int64, float64, slices and maps.
+type otlpRecv struct {
+	time         time.Time
+	severity     int
+	severityText string
+	body         interface{}
+	attributes   map[string]interface{}
+	// traceID and spanID are hex encoded
+	traceID string
+	spanID  string
+	flags   uint64
+}
+
+// fakeCollector is a stand-in OpenTelemetry collector decoding
+// both the protobuf and the JSON OTLP/HTTP logs requests.
+type fakeCollector struct {
+	mu       sync.Mutex
+	records  []otlpRecv
+	resource map[string]interface{}
+	scope    string
+	// failures is the number of requests to respond 503 to
+	failures int32
+	hits     int32
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != otlpLogsPath {
+		http.NotFound(w, r)
+		return
+	}
+	if atomic.AddInt32(&c.hits, 1) <= atomic.LoadInt32(&c.failures) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, _ := ioutil.ReadAll(body)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	switch r.Header.Get("Content-Type") {
+	case "application/x-protobuf":
+		err = c.decodeProtobuf(data)
+	case "application/json":
+		err = c.decodeJSON(data)
+	default:
+		err = errors.New("unsupported content type")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+}
+
+func (c *fakeCollector) decodeProtobuf(data []byte) error {
+	req, err := protoFields(data)
+	if err != nil {
+		return err
+	}
+	for _, rl := range req[1] {
+		resourceLogs, err := protoFields(rl.([]byte))
+		if err != nil {
+			return err
+		}
+		resource, err := protoFields(resourceLogs[1][0].([]byte))
+		if err != nil {
+			return err
+		}
+		if c.resource, err = protoKeyValues(resource[1]); err != nil {
+			return err
+		}
+
+		for _, sl := range resourceLogs[2] {
+			scopeLogs, err := protoFields(sl.([]byte))
+			if err != nil {
+				return err
+			}
+			scope, err := protoFields(scopeLogs[1][0].([]byte))
+			if err != nil {
+				return err
+			}
+			c.scope = string(scope[1][0].([]byte))
+
+			for _, lr := range scopeLogs[2] {
+				record, err := protoFields(lr.([]byte))
+				if err != nil {
+					return err
+				}
+				recv := otlpRecv{
+					time:         time.Unix(0, int64(record[1][0].(uint64))),
+					severity:     int(record[2][0].(uint64)),
+					severityText: string(record[3][0].([]byte)),
+				}
+				if len(record[5]) > 0 {
+					if recv.body, err = protoAnyValueOf(record[5][0].([]byte)); err != nil {
+						return err
+					}
+				}
+				if recv.attributes, err = protoKeyValues(record[6]); err != nil {
+					return err
+				}
+				if len(record[9]) > 0 {
+					recv.flags = record[8][0].(uint64)
+					recv.traceID = hex.EncodeToString(record[9][0].([]byte))
+					recv.spanID = hex.EncodeToString(record[10][0].([]byte))
+				}
+				c.records = append(c.records, recv)
+			}
+		}
+	}
+	return nil
+}
+
+func protoKeyValues(kvs []interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for _, b := range kvs {
+		kv, err := protoFields(b.([]byte))
+		if err != nil {
+			return nil, err
+		}
+		if m[string(kv[1][0].([]byte))], err = protoAnyValueOf(kv[2][0].([]byte)); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func protoAnyValueOf(b []byte) (interface{}, error) {
+	v, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(v[1]) > 0:
+		return string(v[1][0].([]byte)), nil
+	case len(v[2]) > 0:
+		return v[2][0].(uint64) == 1, nil
+	case len(v[3]) > 0:
+		return int64(v[3][0].(uint64)), nil
+	case len(v[4]) > 0:
+		return math.Float64frombits(v[4][0].(uint64)), nil
+	case len(v[5]) > 0:
+		array, err := protoFields(v[5][0].([]byte))
+		if err != nil {
+			return nil, err
+		}
+		values := []interface{}{}
+		for _, e := range array[1] {
+			value, err := protoAnyValueOf(e.([]byte))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case len(v[6]) > 0:
+		list, err := protoFields(v[6][0].([]byte))
+		if err != nil {
+			return nil, err
+		}
+		return protoKeyValues(list[1])
+	}
+	return nil, errors.New("empty AnyValue")
+}
+
+// jsonAny is a JSON encoded AnyValue.
+type jsonAny struct {
+	StringValue *string  `json:"stringValue"`
+	BoolValue   *bool    `json:"boolValue"`
+	IntValue    *string  `json:"intValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+	ArrayValue  *struct {
+		Values []jsonAny `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []jsonKV `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+type jsonKV struct {
+	Key   string  `json:"key"`
+	Value jsonAny `json:"value"`
+}
+
+func (v jsonAny) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		n, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+		return n
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := []interface{}{}
+		for _, e := range v.ArrayValue.Values {
+			values = append(values, e.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return jsonKVs(v.KvlistValue.Values)
+	}
+	return nil
+}
+
+func jsonKVs(kvs []jsonKV) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.value()
+	}
+	return m
+}
+
+func (c *fakeCollector) decodeJSON(data []byte) error {
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []jsonKV `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				LogRecords []struct {
+					TimeUnixNano   string   `json:"timeUnixNano"`
+					SeverityNumber int      `json:"severityNumber"`
+					SeverityText   string   `json:"severityText"`
+					Body           *jsonAny `json:"body"`
+					Attributes     []jsonKV `json:"attributes"`
+					TraceID        string   `json:"traceId"`
+					SpanID         string   `json:"spanId"`
+					Flags          uint64   `json:"flags"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+
+	for _, rl := range req.ResourceLogs {
+		c.resource = jsonKVs(rl.Resource.Attributes)
+		for _, sl := range rl.ScopeLogs {
+			c.scope = sl.Scope.Name
+			for _, lr := range sl.LogRecords {
+				ns, err := strconv.ParseInt(lr.TimeUnixNano, 10, 64)
+				if err != nil {
+					return err
+				}
+				recv := otlpRecv{
+					time:         time.Unix(0, ns),
+					severity:     lr.SeverityNumber,
+					severityText: lr.SeverityText,
+					attributes:   jsonKVs(lr.Attributes),
+					traceID:      lr.TraceID,
+					spanID:       lr.SpanID,
+					flags:        lr.Flags,
+				}
+				if lr.Body != nil {
+					recv.body = lr.Body.value()
+				}
+				c.records = append(c.records, recv)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *fakeCollector) received() []otlpRecv {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]otlpRecv(nil), c.records...)
+}
+
+func TestOTLPWriter(t *testing.T) {
+	exit = func(int) {}
+	t.Cleanup(func() { exit = osExit })
+
+	for _, encoding := range []string{"protobuf", "json"} {
+		c := &fakeCollector{}
+		server := httptest.NewServer(c)
+
+		w, err := NewOTLPWriter(OTLPConfig{
+			URL:         server.URL,
+			JSON:        encoding == "json",
+			ServiceName: "billing",
+			Resource:    map[string]string{"service.version": "1.2.0", "service.name": "ignored"},
+			Gzip:        true,
+			Batch:       fastRetries,
+		})
+		assertion.NoError(t, err)
+
+		logger := New(WithSink(Sink{Name: "otlp", Writer: w, Level: LevelTrace}), WithLevel(LevelTrace))
+		ctx := context.WithValue(context.Background(), ContextData, CtxKeys{UUID: "12345zw", TaskName: "Import"})
+		logger.Info(ctx, LogCatCSV, StatusCatPassed, "imported")
+		logger.WarnWF(ctx, LogCatCSV, StatusCatPending, &Fields{
+			"rows":          12,
+			"ratio":         0.5,
+			"ok":            false,
+			"tags":          []interface{}{"a", 1},
+			"user":          map[string]interface{}{"id": 7},
+			"err":           errors.New("timeout"),
+			"code.filepath": "shadowed",
+		})
+		traced, _ := WithTraceparent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		logger.Error(traced, LogCatSMTP, StatusCatFailed, "failed")
+		logger.Debug(ctx, LogCatDebug, StatusCatDebug, "debug")
+		logger.Trace(ctx, LogCatDebug, StatusCatDebug, "trace")
+		logger.Fatal(ctx, LogCatSMTP, StatusCatFailed, "fatal")
+		assertion.NoError(t, logger.Sync())
+		assertion.NoError(t, w.Close())
+		server.Close()
+
+		assert := assertion.New(t)
+		records := c.received()
+		if !assert.Len(records, 6, encoding) {
+			continue
+		}
+
+		assert.Equal(map[string]interface{}{"service.name": "billing", "service.version": "1.2.0"}, c.resource)
+		assert.Equal(otlpScope, c.scope)
+
+		severities := []int{9, 13, 17, 5, 1, 21}
+		texts := []string{"INFO", "WARN", "ERROR", "DEBUG", "TRACE", "FATAL"}
+		for i, r := range records {
+			assert.Equal(severities[i], r.severity, encoding)
+			assert.Equal(texts[i], r.severityText, encoding)
+		}
+
+		first := records[0]
+		assert.Equal("imported", first.body, encoding)
+		assert.WithinDuration(time.Now(), first.time, time.Minute)
+		assert.Equal(LogCatCSV.Code, first.attributes["apilogger.code"])
+		assert.Equal(LogCatCSV.Type, first.attributes["apilogger.type"])
+		assert.Equal("Passed", first.attributes["apilogger.status"])
+		assert.Equal("12345zw", first.attributes["apilogger.uuid"])
+		assert.Equal("Import", first.attributes["apilogger.taskName"])
+		assert.Equal("otlp_test.go", first.attributes["code.filepath"])
+		assert.IsType(int64(0), first.attributes["code.lineno"])
+		assert.Contains(first.attributes["code.function"], "TestOTLPWriter")
+
+		assert.Empty(first.traceID, encoding)
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", records[2].traceID, encoding)
+		assert.Equal("00f067aa0ba902b7", records[2].spanID, encoding)
+		assert.Equal(uint64(1), records[2].flags, encoding)
+
+		fields := records[1].attributes
+		assert.Nil(records[1].body, encoding)
+		assert.Equal(int64(12), fields["rows"], encoding)
+		assert.Equal(0.5, fields["ratio"], encoding)
+		assert.Equal(false, fields["ok"], encoding)
+		assert.Equal([]interface{}{"a", int64(1)}, fields["tags"], encoding)
+		assert.Equal(map[string]interface{}{"id": int64(7)}, fields["user"], encoding)
+		assert.Equal("timeout", fields["err"], encoding)
+		assert.Equal("shadowed", fields["fields.code.filepath"], encoding)
+	}
+}
+
+func TestOTLPWriterRetries(t *testing.T) {
+	c := &fakeCollector{failures: 2}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	w, err := NewOTLPWriter(OTLPConfig{URL: server.URL + "/", Batch: fastRetries})
+	assertion.NoError(t, err)
+
+	_, err = w.Write([]byte("plain\n"))
+	assertion.NoError(t, err)
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	assert.Equal(int32(3), atomic.LoadInt32(&c.hits))
+	if assert.Len(c.received(), 1) {
+		assert.Equal("plain", c.received()[0].body)
+		assert.Equal(9, c.received()[0].severity)
+	}
+
+	_, err = NewOTLPWriter(OTLPConfig{URL: "collector"})
+	assert.Error(err)
+}
+
+func TestOTLPValueUnsigned(t *testing.T) {
+	assert := assertion.New(t)
+
+	assert.Equal(int64(42), otlpValue(uint(42)))
+	assert.Equal(int64(math.MaxInt64), otlpValue(uint64(math.MaxInt64)))
+	assert.Equal("9223372036854775808", otlpValue(uint64(math.MaxInt64)+1))
+	assert.Equal("18446744073709551615", otlpValue(uint64(math.MaxUint64)))
+	assert.Equal([]interface{}{"18446744073709551615"}, otlpValue([]interface{}{uint64(math.MaxUint64)}))
+}
@@ -0,0 +1,122 @@
+package apilogger
+
+import (
+	"sort"
+	"strings"
+)
+
+// Policy sets the minimum level of the entries per LogCat code,
+// overriding the level of the Logger in both directions. A key
+// ending in '*' matches every code starting with what precedes
+// it, e.g. "KFK*" for all the kafka categories, and LevelOff
+// disables the matching categories entirely. An exact code takes
+// precedence over patterns, and longer patterns over shorter ones.
+type Policy map[string]Level
+
+// compiledPolicy is the form of a Policy consulted on every log
+// call. It is replaced, never modified, so it can be read without
+// holding a lock.
+type compiledPolicy struct {
+	levels Policy
+
+	// prefixes are the patterns of the policy without their
+	// trailing '*', longest first
+	prefixes []string
+}
+
+func compilePolicy(levels Policy) *compiledPolicy {
+	p := &compiledPolicy{levels: levels}
+	for key := range levels {
+		if strings.HasSuffix(key, "*") {
+			p.prefixes = append(p.prefixes, strings.TrimSuffix(key, "*"))
+		}
+	}
+	sort.Slice(p.prefixes, func(i, j int) bool {
+		return len(p.prefixes[i]) > len(p.prefixes[j])
+	})
+	return p
+}
+
+// lookup returns the level set for the LogCat code, if any.
+func (p *compiledPolicy) lookup(code string) (Level, bool) {
+	if level, ok := p.levels[code]; ok {
+		return level, true
+	}
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(code, prefix) {
+			return p.levels[prefix+"*"], true
+		}
+	}
+	return LevelInfo, false
+}
+
+// policy returns the current policy of the Logger.
+func (l *Logger) policy() *compiledPolicy {
+	p, _ := l.categories.Load().(*compiledPolicy)
+	if p == nil {
+		return &compiledPolicy{}
+	}
+	return p
+}
+
+// updatePolicy replaces the policy of the Logger by a modified
+// copy, update receives the copy to change in place.
+func (l *Logger) updatePolicy(update func(levels Policy)) {
+	l.categoriesMu.Lock()
+	defer l.categoriesMu.Unlock()
+
+	current := l.policy().levels
+	levels := make(Policy, len(current)+1)
+	for code, level := range current {
+		levels[code] = level
+	}
+	update(levels)
+	l.categories.Store(compilePolicy(levels))
+}
+
+// SetCategoryLevel sets the minimum level of the entries of the
+// LogCat with the given code, or of the codes matching the given
+// pattern, see Policy. It is safe to call while other goroutines
+// are logging.
+func (l *Logger) SetCategoryLevel(code string, level Level) {
+	l.updatePolicy(func(levels Policy) {
+		levels[code] = level
+	})
+}
+
+// DisableCategory drops every entry of the LogCat with the
+// given code, or of the codes matching the given pattern.
+func (l *Logger) DisableCategory(code string) {
+	l.SetCategoryLevel(code, LevelOff)
+}
+
+// ClearCategoryLevel removes the level set for the LogCat with the
+// given code or pattern, its entries follow the level of the Logger
+// again unless another pattern matches them.
+func (l *Logger) ClearCategoryLevel(code string) {
+	l.updatePolicy(func(levels Policy) {
+		delete(levels, code)
+	})
+}
+
+// SetPolicy replaces all the levels set per LogCat code or pattern.
+func (l *Logger) SetPolicy(policy Policy) {
+	l.updatePolicy(func(levels Policy) {
+		for code := range levels {
+			delete(levels, code)
+		}
+		for code, level := range policy {
+			levels[code] = level
+		}
+	})
+}
+
+// CategoryLevels returns a copy of the levels set per LogCat code or pattern.
+func (l *Logger) CategoryLevels() map[string]Level {
+	current := l.policy().levels
+	levels := make(map[string]Level, len(current))
+	for code, level := range current {
+		levels[code] = level
+	}
+	return levels
+}
@@ -0,0 +1,80 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+func TestPolicyLookup(t *testing.T) {
+	p := compilePolicy(Policy{
+		"KFK*":   LevelWarn,
+		"KFK00*": LevelError,
+		"KFK007": LevelOff,
+		"*":      LevelDebug,
+	})
+	assert := assertion.New(t)
+
+	for code, expected := range map[string]Level{
+		"KFK007": LevelOff,
+		"KFK001": LevelError,
+		"KFK011": LevelWarn,
+		"HTH001": LevelDebug,
+	} {
+		level, ok := p.lookup(code)
+		assert.True(ok, code)
+		assert.Equal(expected, level, code)
+	}
+
+	_, ok := compilePolicy(Policy{"KFK*": LevelWarn}).lookup("HTH001")
+	assert.False(ok)
+}
+
+func TestPolicyFiltersEntries(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	logger := New(WithPolicy(Policy{
+		"KFK*":                    LevelWarn,
+		LogCatKafkaProduce.Code:   LevelDebug,
+		LogCatHealth.Code:         LevelOff,
+		LogCatCacheRead.Code:      LevelError,
+		LogCatDatastoreClose.Code: LevelTrace,
+	}))
+	logger.output = &out
+	logger.errOutput = &errOut
+
+	ctx := context.Background()
+	logger.Info(ctx, LogCatKafkaConsume, StatusCatPassed, "dropped")
+	logger.Warn(ctx, LogCatKafkaConsume, StatusCatPending, "kept KFK007")
+	logger.Debug(ctx, LogCatKafkaProduce, StatusCatDebug, "kept KFK008")
+	logger.Error(ctx, LogCatHealth, StatusCatFailed, "dropped")
+	logger.Warn(ctx, LogCatCacheRead, StatusCatPending, "dropped")
+	logger.Trace(ctx, LogCatDatastoreClose, StatusCatDebug, "kept DTA002")
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "kept DBG001")
+
+	assert := assertion.New(t)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(lines, 4)
+	for i, code := range []string{"KFK007", "KFK008", "DTA002", "DBG001"} {
+		assert.Contains(lines[i], "kept "+code)
+	}
+	assert.Empty(errOut.String())
+
+	logger.DisableCategory("*")
+	logger.Error(ctx, LogCatDebug, StatusCatFailed, "dropped")
+	assert.Empty(errOut.String())
+
+	logger.SetPolicy(nil)
+	assert.Empty(logger.CategoryLevels())
+	logger.Error(ctx, LogCatHealth, StatusCatFailed, "kept")
+	assert.NotEmpty(errOut.String())
+}
+
+func TestParseLevelOff(t *testing.T) {
+	level, err := ParseLevel("off")
+	assertion.NoError(t, err)
+	assertion.Equal(t, LevelOff, level)
+}
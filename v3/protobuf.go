@@ -0,0 +1,97 @@
+package apilogger
+
+import "encoding/binary"
+
+// protoBuffer appends protocol buffers fields, enough to
+// serialize the messages of the shipping sinks without
+// generated code.
+type protoBuffer struct {
+	b []byte
+}
+
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+func (p *protoBuffer) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	p.b = append(p.b, b[:n]...)
+}
+
+func (p *protoBuffer) tag(field int, wireType int) {
+	p.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64Field appends a varint field, omitted when zero.
+func (p *protoBuffer) uint64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoVarint)
+	p.varint(v)
+}
+
+// int64Field appends an int64 varint field, omitted when zero.
+func (p *protoBuffer) int64Field(field int, v int64) {
+	p.uint64Field(field, uint64(v))
+}
+
+// fixed64Field appends a fixed64 field, omitted when zero.
+func (p *protoBuffer) fixed64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoFixed64)
+	p.fixed64(v)
+}
+
+func (p *protoBuffer) fixed64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	p.b = append(p.b, b[:]...)
+}
+
+// fixed32Field appends a fixed32 field, omitted when zero.
+func (p *protoBuffer) fixed32Field(field int, v uint32) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoFixed32)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	p.b = append(p.b, b[:]...)
+}
+
+// stringField appends a string field, omitted when empty.
+func (p *protoBuffer) stringField(field int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(field, protoBytes)
+	p.varint(uint64(len(v)))
+	p.b = append(p.b, v...)
+}
+
+// bytesField appends a bytes field, omitted when empty.
+func (p *protoBuffer) bytesField(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	p.tag(field, protoBytes)
+	p.varint(uint64(len(v)))
+	p.b = append(p.b, v...)
+}
+
+// messageField appends the embedded message written by fn,
+// even when it is empty.
+func (p *protoBuffer) messageField(field int, fn func(m *protoBuffer)) {
+	var m protoBuffer
+	fn(&m)
+	p.tag(field, protoBytes)
+	p.varint(uint64(len(m.b)))
+	p.b = append(p.b, m.b...)
+}
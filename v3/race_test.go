@@ -0,0 +1,137 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, so
+// the test itself does not race when reading the output.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// stubExit replaces exit for the duration of the test.
+func stubExit(t *testing.T) *int {
+	exits := new(int)
+	var mu sync.Mutex
+	exit = func(int) {
+		mu.Lock()
+		*exits++
+		mu.Unlock()
+	}
+	t.Cleanup(func() { exit = osExit })
+	return exits
+}
+
+var osExit = exit
+
+func TestConcurrentLogging(t *testing.T) {
+	const goroutines, iterations = 16, 200
+
+	out, errOut := &syncBuffer{}, &syncBuffer{}
+	logger := New(WithLevel(LevelTrace))
+	logger.output = out
+	logger.errOutput = errOut
+	exits := stubExit(t)
+
+	ctx := NewContextLogger(context.Background(), "stress")
+	fields := &Fields{"step": "000"}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				switch (g + i) % 7 {
+				case 0:
+					logger.Trace(ctx, LogCatDebug, StatusCatDebug, "trace")
+				case 1:
+					logger.Debugf(ctx, LogCatDebug, StatusCatDebug, "debug %d", i)
+				case 2:
+					logger.InfoWF(ctx, LogCatDebug, StatusCatPassed, fields)
+				case 3:
+					Warn(ctx, LogCatDebug, StatusCatPending, "warn")
+				case 4:
+					logger.Errorf(ctx, LogCatDebug, StatusCatFailed, "error %d", i)
+				case 5:
+					logger.FatalWF(ctx, LogCatDebug, StatusCatFailed, fields)
+				case 6:
+					logger.SetLevel(LevelTrace)
+					logger.SetCategoryLevel(LogCatHealth.Code, LevelError)
+				}
+			}
+		}(g)
+	}
+
+	// reconfigure while the goroutines log
+	assertion.NoError(t, logger.SetOutputFile(filepath.Join(t.TempDir(), "stress.log")))
+	wg.Wait()
+
+	assert := assertion.New(t)
+
+	stdLines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	errLines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+	fatals := 0
+	for _, line := range stdLines {
+		assert.Regexp(`^(TRACE|DEBUG|INFO|WARN) `, line)
+		assert.Equal(1, strings.Count(line, "uuid="), line)
+	}
+	for _, line := range errLines {
+		assert.Regexp(`^(ERROR|FATAL) `, line)
+		assert.Equal(1, strings.Count(line, "uuid="), line)
+		if strings.HasPrefix(line, "FATAL ") {
+			fatals++
+		}
+	}
+
+	// every case but the reconfiguration writes a line
+	expected := 0
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < iterations; i++ {
+			if (g+i)%7 != 6 {
+				expected++
+			}
+		}
+	}
+	assert.Equal(*exits, fatals)
+	assert.Equal(expected, len(stdLines)+len(errLines), "lines lost or merged")
+}
+
+func TestFatalKeepsErrorPrefix(t *testing.T) {
+	var errOut bytes.Buffer
+	logger := New()
+	logger.errOutput = &errOut
+	exits := stubExit(t)
+
+	ctx := context.Background()
+	logger.Fatal(ctx, LogCatDebug, StatusCatFailed, "fatal")
+	logger.Error(ctx, LogCatDebug, StatusCatFailed, "error")
+
+	lines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+	assert := assertion.New(t)
+	assert.Equal(1, *exits)
+	assert.Len(lines, 2)
+	assert.True(strings.HasPrefix(lines[0], "FATAL "), lines[0])
+	assert.True(strings.HasPrefix(lines[1], "ERROR "), lines[1])
+}
@@ -0,0 +1,145 @@
+package apilogger
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// reopener is implemented by the files that can be reopened
+// once they were moved away, e.g. by logrotate.
+type reopener interface {
+	Reopen() error
+}
+
+// logFile is a file opened for appending by SetOutputFile,
+// that can be reopened at the same path.
+type logFile struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openLogFile opens, or creates, the file at path for appending.
+func openLogFile(path string) (*logFile, error) {
+	file, err := os.OpenFile(
+		path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{path: path, file: file}, nil
+}
+
+// Write implements io.Writer.
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, errFileClosed
+	}
+	return f.file.Write(p)
+}
+
+// Reopen opens the file at the path again and closes the previous
+// one. The previous file is kept when the new one cannot be opened.
+func (f *logFile) Reopen() error {
+	file, err := os.OpenFile(
+		f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		file.Close()
+		return errFileClosed
+	}
+	old := f.file
+	f.file = file
+	return old.Close()
+}
+
+// Sync commits the content of the file to stable storage.
+func (f *logFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return errFileClosed
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file.
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return errFileClosed
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Reopen reopens the files set with SetOutputFile and
+// SetOutputRotatingFile at their paths, so logging goes on in new
+// files once they were moved away. No line is written while the
+// files are swapped, so none is lost or split across them.
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	for _, c := range l.closers {
+		if r, ok := c.(reopener); ok {
+			if reopenErr := r.Reopen(); err == nil {
+				err = reopenErr
+			}
+		}
+	}
+	return err
+}
+
+// ReopenOnSignal calls Reopen whenever one of the signals is
+// received, SIGHUP when none is given, which is what logrotate
+// sends from postrotate scripts. The returned function stops it.
+func (l *Logger) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := l.Reopen(); err != nil {
+					log.Println("Failed to reopen log files", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package apilogger
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+func TestLoggerReopen(t *testing.T) {
+	const goroutines, iterations = 4, 200
+
+	logger := New()
+	logger.output = ioutil.Discard
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.log")
+	rotating := filepath.Join(dir, "rotating.log")
+	assert := assertion.New(t)
+
+	assert.NoError(logger.SetOutputFile(plain))
+	assert.NoError(logger.SetOutputRotatingFile(RotateConfig{Filename: rotating}))
+	defer logger.Close()
+
+	ctx := NewContextLogger(context.Background(), "reopen")
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				logger.Info(ctx, LogCatDebug, StatusCatDebug, "line")
+			}
+		}()
+	}
+
+	// what logrotate does while the service logs
+	time.Sleep(time.Millisecond)
+	assert.NoError(os.Rename(plain, plain+".1"))
+	assert.NoError(os.Rename(rotating, rotating+".1"))
+	assert.NoError(logger.Reopen())
+	wg.Wait()
+	assert.NoError(logger.Sync())
+
+	for _, path := range []string{plain, rotating} {
+		var content string
+		for _, name := range []string{path + ".1", path} {
+			data, err := ioutil.ReadFile(name)
+			assert.NoError(err)
+			content += string(data)
+		}
+		// either file may be empty, depending on when the rename happened
+		assert.Equal(goroutines*iterations, strings.Count(content, "\n"), path)
+		assert.Equal(goroutines*iterations, strings.Count(content, "INFO "), path)
+	}
+}
+
+func TestReopenOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported")
+	}
+
+	logger := New()
+	logger.output = ioutil.Discard
+	path := filepath.Join(t.TempDir(), "api.log")
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	assert.NoError(logger.SetOutputFile(path))
+	defer logger.Close()
+	stop := logger.ReopenOnSignal()
+	defer stop()
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "before")
+	assert.NoError(os.Rename(path, path+".1"))
+
+	process, err := os.FindProcess(os.Getpid())
+	assert.NoError(err)
+	assert.NoError(process.Signal(syscall.SIGHUP))
+	assert.Eventually(func() bool {
+		return fileExists(path)
+	}, time.Second, 5*time.Millisecond)
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "after")
+
+	data, err := ioutil.ReadFile(path + ".1")
+	assert.NoError(err)
+	assert.Contains(string(data), "before")
+	assert.NotContains(string(data), "after")
+
+	data, err = ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Contains(string(data), "after")
+	assert.NotContains(string(data), "before")
+
+	stop()
+	stop()
+}
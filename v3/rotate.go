@@ -0,0 +1,422 @@
+package apilogger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp added to the name of
+// rotated files, e.g. app-20240923T112955.120.log.
+const backupTimeFormat = "20060102T150405.000"
+
+// rotateRetryDelay is how long a failed rotation waits before
+// being tried again, so a persistent error does not cost a
+// rename on every write.
+const rotateRetryDelay = time.Minute
+
+// errFileClosed is returned when using a closed RotatingFile.
+var errFileClosed = errors.New("apilogger: log file already closed")
+
+// RotateConfig configures a RotatingFile.
+type RotateConfig struct {
+	// Filename is the file written to. Rotated files are
+	// kept in the same directory.
+	Filename string
+
+	// MaxSize is the size in bytes a file may reach before it
+	// is rotated. Zero disables size based rotation.
+	MaxSize int64
+
+	// Daily rotates the file on the first write of every day.
+	Daily bool
+
+	// MaxBackups is the number of rotated files kept,
+	// the oldest are removed first. Zero keeps them all.
+	MaxBackups int
+
+	// MaxAge is how long rotated files are kept.
+	// Zero keeps them regardless of their age.
+	MaxAge time.Duration
+
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// RotatingFile is an io.WriteCloser appending to a file that is
+// rotated once it grows past a maximum size and/or every day. The
+// rotated file is renamed with a timestamp and optionally compressed,
+// and old rotated files are removed, in the background. It is safe
+// for concurrent use, a write is never split across two files.
+type RotatingFile struct {
+	cfg RotateConfig
+
+	mu sync.Mutex
+	// file is nil once closed, or when it could
+	// not be opened again after a rotation
+	file   *os.File
+	closed bool
+	size   int64
+	// day is the day the current file was started
+	day string
+	// retryAt is when a failed rotation is tried again
+	retryAt time.Time
+
+	// now returns the current time and rename renames
+	// files, replaced in tests
+	now    func() time.Time
+	rename func(oldpath, newpath string) error
+
+	millCh   chan struct{}
+	millDone chan struct{}
+}
+
+// NewRotatingFile opens, or creates, the file of the config for
+// appending. Existing content counts towards the maximum size.
+func NewRotatingFile(cfg RotateConfig) (*RotatingFile, error) {
+	if cfg.Filename == "" {
+		return nil, errors.New("apilogger: rotating file without a name")
+	}
+
+	r := &RotatingFile{
+		cfg:      cfg,
+		now:      time.Now,
+		rename:   os.Rename,
+		millCh:   make(chan struct{}, 1),
+		millDone: make(chan struct{}),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	go r.mill()
+	return r, nil
+}
+
+// open opens the file for appending. It must be called with mu held.
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(
+		r.cfg.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.day = dayOf(r.now())
+	if r.size > 0 {
+		// the file was started on the day it was last written
+		r.day = dayOf(info.ModTime())
+	}
+	return nil
+}
+
+// Write implements io.Writer, rotating the file first when p
+// would not fit in it or when the day changed.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reopenLost(); err != nil {
+		return 0, err
+	}
+
+	if r.size > 0 && r.due(int64(len(p))) && !r.now().Before(r.retryAt) {
+		if err := r.rotate(); err != nil {
+			if r.file == nil {
+				return 0, err
+			}
+			// the line is written to the current file and
+			// the rotation is tried again after a delay
+			r.retryAt = r.now().Add(rotateRetryDelay)
+			log.Println("Failed to rotate log file", err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// reopenLost opens the file again when it was lost by a failed
+// rotation. It must be called with mu held.
+func (r *RotatingFile) reopenLost() error {
+	if r.closed {
+		return errFileClosed
+	}
+	if r.file == nil {
+		return r.open()
+	}
+	return nil
+}
+
+// due reports whether the file must be rotated before
+// writing n more bytes. It must be called with mu held.
+func (r *RotatingFile) due(n int64) bool {
+	if r.cfg.MaxSize > 0 && r.size+n > r.cfg.MaxSize {
+		return true
+	}
+	return r.cfg.Daily && dayOf(r.now()) != r.day
+}
+
+// Rotate rotates the file regardless of its size or age.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reopenLost(); err != nil {
+		return err
+	}
+	return r.rotate()
+}
+
+// rotate renames the current file to its backup name and starts
+// a new one. When the rename fails the current file is reopened,
+// so it is still written to. It must be called with mu held.
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		// the file cannot be written to anymore
+		// even though closing it failed
+		r.file = nil
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	renameErr := r.rename(r.cfg.Filename, r.backupName(r.now()))
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	if renameErr != nil && !os.IsNotExist(renameErr) {
+		return renameErr
+	}
+
+	select {
+	case r.millCh <- struct{}{}:
+	default:
+		// a run is already pending
+	}
+	return nil
+}
+
+// Reopen opens the file at its name again, e.g. once an external
+// tool moved it away, and closes the previous one.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errFileClosed
+	}
+	// the current file is kept when the new one cannot be opened
+	old := r.file
+	if err := r.open(); err != nil {
+		return err
+	}
+	if old == nil {
+		return nil
+	}
+	return old.Close()
+}
+
+// Sync commits the content of the current file to stable storage.
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reopenLost(); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// Close closes the current file and waits for the pending
+// compression and removal of rotated files.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return errFileClosed
+	}
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+	}
+	r.file = nil
+	r.closed = true
+	r.mu.Unlock()
+
+	close(r.millCh)
+	<-r.millDone
+	return err
+}
+
+// backupName returns the name of the file rotated at t. When
+// a file was already rotated within the same millisecond, the
+// timestamp is moved forward so no backup is overwritten.
+func (r *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := r.nameParts()
+	for {
+		name := filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// nameParts splits the file name into its directory, the prefix
+// of its backups and its extension.
+func (r *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(r.cfg.Filename)
+	base := filepath.Base(r.cfg.Filename)
+	ext = filepath.Ext(base)
+	prefix = strings.TrimSuffix(base, ext) + "-"
+	return dir, prefix, ext
+}
+
+// mill compresses and removes rotated files after every rotation,
+// one run at a time, until the file is closed.
+func (r *RotatingFile) mill() {
+	defer close(r.millDone)
+
+	for range r.millCh {
+		if err := r.millRun(); err != nil {
+			log.Println("Failed to clean up rotated log files", err)
+		}
+	}
+}
+
+// backup is a rotated file found next to the current one.
+type backup struct {
+	path    string
+	rotated time.Time
+}
+
+// millRun removes the rotated files exceeding MaxBackups or
+// MaxAge, then compresses the remaining ones if required.
+func (r *RotatingFile) millRun() error {
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	var keep []backup
+	cutoff := r.now().Add(-r.cfg.MaxAge)
+	for i, b := range backups {
+		expired := r.cfg.MaxAge > 0 && b.rotated.Before(cutoff)
+		extra := r.cfg.MaxBackups > 0 && i >= r.cfg.MaxBackups
+		if expired || extra {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		keep = append(keep, b)
+	}
+
+	if !r.cfg.Compress {
+		return nil
+	}
+	for _, b := range keep {
+		if strings.HasSuffix(b.path, ".gz") {
+			continue
+		}
+		if err := compressFile(b.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backups returns the rotated files, newest first.
+func (r *RotatingFile) backups() ([]backup, error) {
+	dir, prefix, ext := r.nameParts()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		rotated, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			// not one of our backups
+			continue
+		}
+		backups = append(backups, backup{filepath.Join(dir, name), rotated})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotated.After(backups[j].rotated)
+	})
+	return backups, nil
+}
+
+// compressFile gzips the file to path.gz and removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("compressing %s: %w", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
+
+// fileExists reports whether there is a file at path.
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// dayOf returns the local calendar day of t.
+func dayOf(t time.Time) string {
+	return t.Format("2006-01-02")
+}
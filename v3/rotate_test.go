@@ -0,0 +1,367 @@
+package apilogger
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a settable time source.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestRotatingFile returns a RotatingFile in a temporary
+// directory, using clock as time source when set.
+func newTestRotatingFile(t *testing.T, cfg RotateConfig, clock *fakeClock) *RotatingFile {
+	cfg.Filename = filepath.Join(t.TempDir(), "app.log")
+
+	r, err := NewRotatingFile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clock != nil {
+		r.now = clock.Now
+		r.day = dayOf(clock.Now())
+	}
+	return r
+}
+
+// readLogFiles returns the content of the current and rotated
+// files, oldest first, decompressing the gzipped ones.
+func readLogFiles(t *testing.T, r *RotatingFile) []string {
+	dir := filepath.Dir(r.cfg.Filename)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		if f.Name() != "app.log" {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	names = append(names, "app.log")
+
+	var contents []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data []byte
+		if strings.HasSuffix(name, ".gz") {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err = ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			data, err = ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	r := newTestRotatingFile(t, RotateConfig{MaxSize: 100}, nil)
+	assert := assertion.New(t)
+
+	for i := 0; i < 10; i++ {
+		_, err := fmt.Fprintf(r, "line %02d %s\n", i, strings.Repeat("x", 20))
+		assert.NoError(err)
+	}
+	assert.NoError(r.Close())
+
+	contents := readLogFiles(t, r)
+	assert.Len(contents, 4)
+	for _, content := range contents {
+		assert.True(len(content) <= 100, content)
+	}
+	assert.Equal(10, strings.Count(strings.Join(contents, ""), "\n"))
+	assert.True(strings.HasPrefix(contents[0], "line 00 "))
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	r := newTestRotatingFile(t, RotateConfig{MaxSize: 10}, nil)
+	r.rename = func(string, string) error { return os.ErrPermission }
+	assert := assertion.New(t)
+
+	// the lines go on in the current file
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		n, err := r.Write([]byte(line))
+		assert.NoError(err)
+		assert.Equal(len(line), n)
+	}
+	assert.Error(r.Rotate())
+	assert.NoError(r.Close())
+	assert.Equal([]string{"line 1\nline 2\nline 3\n"}, readLogFiles(t, r))
+}
+
+func TestRotatingFileRenameBackoff(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 23, 11, 0, 0, 0, time.Local)}
+	r := newTestRotatingFile(t, RotateConfig{MaxSize: 10}, clock)
+	renames := 0
+	r.rename = func(string, string) error {
+		renames++
+		return os.ErrPermission
+	}
+	assert := assertion.New(t)
+
+	for i := 0; i < 5; i++ {
+		_, err := r.Write([]byte("line\n"))
+		assert.NoError(err)
+	}
+	assert.Equal(1, renames)
+
+	// the rotation is tried again once the delay elapsed
+	clock.Add(rotateRetryDelay)
+	r.rename = os.Rename
+	_, err := r.Write([]byte("last\n"))
+	assert.NoError(err)
+	assert.NoError(r.Close())
+	assert.Equal([]string{strings.Repeat("line\n", 5), "last\n"}, readLogFiles(t, r))
+}
+
+func TestRotatingFileCloseFails(t *testing.T) {
+	r := newTestRotatingFile(t, RotateConfig{MaxSize: 10}, nil)
+	assert := assertion.New(t)
+
+	_, err := r.Write([]byte("line 1\n"))
+	assert.NoError(err)
+
+	// closing the current file fails during the rotation,
+	// which goes on in the file opened again
+	assert.NoError(r.file.Close())
+	_, err = r.Write([]byte("line 2\n"))
+	assert.NoError(err)
+	_, err = r.Write([]byte("line 3\n"))
+	assert.NoError(err)
+	assert.NoError(r.Close())
+	assert.Equal([]string{"line 1\nline 2\nline 3\n"}, readLogFiles(t, r))
+}
+
+func TestRotatingFileReopenFails(t *testing.T) {
+	r := newTestRotatingFile(t, RotateConfig{MaxSize: 10}, nil)
+	// a directory takes the place of the rotated file
+	r.rename = func(oldpath, newpath string) error {
+		if err := os.Rename(oldpath, newpath); err != nil {
+			return err
+		}
+		return os.Mkdir(oldpath, 0777)
+	}
+	assert := assertion.New(t)
+
+	_, err := r.Write([]byte("line 1\n"))
+	assert.NoError(err)
+	_, err = r.Write([]byte("line 2\n"))
+	assert.Error(err)
+
+	// the file is opened again once it can be
+	assert.NoError(os.Remove(r.cfg.Filename))
+	r.rename = os.Rename
+	_, err = r.Write([]byte("line 3\n"))
+	assert.NoError(err)
+	assert.NoError(r.Close())
+	assert.Equal([]string{"line 1\n", "line 3\n"}, readLogFiles(t, r))
+
+	// closing a file lost by a rotation stops the mill
+	r = newTestRotatingFile(t, RotateConfig{}, nil)
+	r.rename = func(oldpath, newpath string) error {
+		if err := os.Rename(oldpath, newpath); err != nil {
+			return err
+		}
+		return os.Mkdir(oldpath, 0777)
+	}
+	assert.Error(r.Rotate())
+	assert.NoError(r.Close())
+	<-r.millDone
+	assert.Equal(errFileClosed, r.Close())
+}
+
+func TestRotatingFileDaily(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 23, 23, 59, 0, 0, time.Local)}
+	r := newTestRotatingFile(t, RotateConfig{Daily: true}, clock)
+	assert := assertion.New(t)
+
+	_, _ = r.Write([]byte("monday\n"))
+	clock.Add(30 * time.Second)
+	_, _ = r.Write([]byte("still monday\n"))
+	clock.Add(time.Minute)
+	_, _ = r.Write([]byte("tuesday\n"))
+	assert.NoError(r.Close())
+
+	_, err := os.Stat(filepath.Join(filepath.Dir(r.cfg.Filename), "app-20240924T000030.000.log"))
+	assert.NoError(err)
+	assert.Equal([]string{"monday\nstill monday\n", "tuesday\n"}, readLogFiles(t, r))
+}
+
+func TestRotatingFileBackupsAndCompression(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 23, 10, 0, 0, 0, time.Local)}
+	r := newTestRotatingFile(t, RotateConfig{MaxBackups: 2, Compress: true}, clock)
+	assert := assertion.New(t)
+
+	for i := 0; i < 4; i++ {
+		_, _ = fmt.Fprintf(r, "file %d\n", i)
+		clock.Add(time.Second)
+		assert.NoError(r.Rotate())
+	}
+	_, _ = r.Write([]byte("current\n"))
+	assert.NoError(r.Close())
+
+	backups, err := r.backups()
+	assert.NoError(err)
+	assert.Len(backups, 2)
+	for _, b := range backups {
+		assert.True(strings.HasSuffix(b.path, ".gz"), b.path)
+	}
+	assert.Equal([]string{"file 2\n", "file 3\n", "current\n"}, readLogFiles(t, r))
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 23, 10, 0, 0, 0, time.Local)}
+	r := newTestRotatingFile(t, RotateConfig{MaxAge: 24 * time.Hour}, clock)
+	assert := assertion.New(t)
+
+	dir := filepath.Dir(r.cfg.Filename)
+	old := filepath.Join(dir, "app-20240920T100000.000.log.gz")
+	recent := filepath.Join(dir, "app-20240923T090000.000.log")
+	unrelated := filepath.Join(dir, "app-notes.log")
+	for _, path := range []string{old, recent, unrelated} {
+		assert.NoError(ioutil.WriteFile(path, []byte("x\n"), 0666))
+	}
+
+	_, _ = r.Write([]byte("rotated\n"))
+	assert.NoError(r.Rotate())
+	assert.NoError(r.Close())
+
+	assert.False(fileExists(old))
+	assert.True(fileExists(recent))
+	assert.True(fileExists(unrelated))
+	assert.True(fileExists(filepath.Join(dir, "app-20240923T100000.000.log")))
+}
+
+func TestRotatingFileConcurrentWrites(t *testing.T) {
+	const goroutines, iterations = 8, 200
+
+	r := newTestRotatingFile(t, RotateConfig{MaxSize: 1024, Compress: true}, nil)
+	line := strings.Repeat("y", 63) + "\n"
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				if _, err := r.Write([]byte(line)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assertion.NoError(t, r.Close())
+
+	total := 0
+	for _, content := range readLogFiles(t, r) {
+		assertion.True(t, len(content) <= 1024)
+		assertion.Equal(t, strings.Repeat(line, len(content)/len(line)), content)
+		total += strings.Count(content, "\n")
+	}
+	assertion.Equal(t, goroutines*iterations, total)
+}
+
+func TestLoggerRotatingFile(t *testing.T) {
+	logger := New()
+	logger.output = ioutil.Discard
+	logger.errOutput = ioutil.Discard
+
+	filename := filepath.Join(t.TempDir(), "task.log")
+	assertion.NoError(t, logger.SetOutputRotatingFile(RotateConfig{Filename: filename, MaxSize: 1 << 20}))
+
+	logger.Info(NewContextLogger(context.Background(), "rotating"), LogCatDebug, StatusCatDebug, "to file")
+
+	data, err := ioutil.ReadFile(filename)
+	assertion.NoError(t, err)
+	assertion.Contains(t, string(data), `message="to file"`)
+}
+
+func TestLoggerClose(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New()
+	logger.output = out
+	dir := t.TempDir()
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	assert.NoError(logger.SetOutputFile(filepath.Join(dir, "plain.log")))
+	assert.NoError(logger.SetOutputRotatingFile(RotateConfig{Filename: filepath.Join(dir, "rotating.log")}))
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "to files")
+	assert.NoError(logger.Sync())
+	assert.NoError(logger.Close())
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "after close")
+
+	for _, name := range []string{"plain.log", "rotating.log"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(err)
+		assert.Contains(string(data), "to files", name)
+		assert.NotContains(string(data), "after close", name)
+	}
+	assert.Contains(out.String(), "after close")
+	assert.Equal(out, logger.output)
+
+	// closing again is a no-op
+	assert.NoError(logger.Close())
+}
+
+func TestFatalSyncsFiles(t *testing.T) {
+	exits := stubExit(t)
+	logger := New()
+	logger.errOutput = ioutil.Discard
+	path := filepath.Join(t.TempDir(), "fatal.log")
+
+	assertion.NoError(t, logger.SetOutputFile(path))
+	defer logger.Close()
+	logger.Fatal(context.Background(), LogCatDebug, StatusCatFailed, "fatal")
+
+	data, err := ioutil.ReadFile(path)
+	assertion.NoError(t, err)
+	assertion.Equal(t, 1, *exits)
+	assertion.True(t, strings.HasPrefix(string(data), "FATAL "), string(data))
+}
@@ -0,0 +1,115 @@
+package apilogger
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+const (
+	// Stdout is the name of the standard output of a Logger,
+	// including the files added by SetOutputFile, in Routes.
+	Stdout = "stdout"
+
+	// Stderr is the name of the error output of a Logger,
+	// including the files added by SetOutputFile, in Routes.
+	Stderr = "stderr"
+)
+
+// Routes maps levels to the names of the writers their entries are
+// written to, Stdout, Stderr or writers added by RegisterWriter.
+// Levels without a route are written to Stdout below LevelError
+// and to Stderr from it. Routes do not apply once sinks are added.
+type Routes map[Level][]string
+
+// RouteAll returns the Routes writing every level to the named
+// writers, e.g. RouteAll(Stdout) to keep all the lines of a request
+// in one stream and in order.
+func RouteAll(names ...string) Routes {
+	routes := make(Routes)
+	for level := LevelTrace; level <= LevelFatal; level++ {
+		routes[level] = names
+	}
+	return routes
+}
+
+// WithRoutes sets the routes of the Logger, see SetRoutes.
+func WithRoutes(routes Routes) Option {
+	return func(l *Logger) {
+		if err := l.SetRoutes(routes); err != nil {
+			log.Println("Failed to set log routes", err)
+		}
+	}
+}
+
+// RegisterWriter makes w available to Routes under the given name,
+// replacing the writer previously registered under it.
+func (l *Logger) RegisterWriter(name string, w io.Writer) error {
+	if name == Stdout || name == Stderr {
+		return fmt.Errorf("apilogger: writer name %q is reserved", name)
+	}
+	if w == nil {
+		return fmt.Errorf("apilogger: writer %q is nil", name)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.writers == nil {
+		l.writers = make(map[string]io.Writer)
+	}
+	l.writers[name] = w
+	return nil
+}
+
+// SetRoutes replaces the routes of the Logger. Every named
+// writer must be Stdout, Stderr or registered. It is safe to
+// call while other goroutines are logging.
+func (l *Logger) SetRoutes(routes Routes) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	copied := make(Routes, len(routes))
+	for level, names := range routes {
+		for _, name := range names {
+			if _, ok := l.writer(name); !ok {
+				return fmt.Errorf("apilogger: unknown writer %q for level %s", name, level)
+			}
+		}
+		copied[level] = append([]string(nil), names...)
+	}
+	l.routes = copied
+	return nil
+}
+
+// writer returns the writer with the given name.
+// It must be called with mu held.
+func (l *Logger) writer(name string) (io.Writer, bool) {
+	switch name {
+	case Stdout:
+		return l.output, true
+	case Stderr:
+		return l.errOutput, true
+	}
+	w, ok := l.writers[name]
+	return w, ok
+}
+
+// route appends the writers of the level to ws.
+// It must be called with mu held.
+func (l *Logger) route(level Level, ws []io.Writer) []io.Writer {
+	names, ok := l.routes[level]
+	if !ok {
+		if level >= LevelError {
+			return append(ws, l.errOutput)
+		}
+		return append(ws, l.output)
+	}
+
+	for _, name := range names {
+		if w, ok := l.writer(name); ok {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
@@ -0,0 +1,80 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+func TestRouteAllToStdout(t *testing.T) {
+	out, errOut := &syncBuffer{}, &syncBuffer{}
+	logger := New(WithLevel(LevelTrace), WithRoutes(RouteAll(Stdout)))
+	logger.output = out
+	logger.errOutput = errOut
+	exits := stubExit(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				logger.Infof(ctx, LogCatDebug, StatusCatDebug, "%d-%d", g, i)
+				logger.Errorf(ctx, LogCatDebug, StatusCatFailed, "%d-%d", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	logger.Fatal(ctx, LogCatDebug, StatusCatFailed, "fatal")
+
+	assert := assertion.New(t)
+	assert.Empty(errOut.String())
+	assert.Equal(1, *exits)
+
+	// the lines of every goroutine are in order
+	lines := messages(out.String())
+	assert.Len(lines, 401)
+	next := make(map[string]int)
+	for _, line := range lines[:400] {
+		parts := strings.Split(line, "-")
+		assert.Equal(strconv.Itoa(next[parts[0]]/2), parts[1], line)
+		next[parts[0]]++
+	}
+	assert.Equal("fatal", lines[400])
+}
+
+func TestRoutes(t *testing.T) {
+	var out, errOut, audit, alerts bytes.Buffer
+	logger := New()
+	logger.output = &out
+	logger.errOutput = &errOut
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	assert.NoError(logger.RegisterWriter("audit", &audit))
+	assert.NoError(logger.RegisterWriter("alerts", &alerts))
+	assert.Error(logger.RegisterWriter(Stdout, &audit))
+	assert.Error(logger.RegisterWriter("nil", nil))
+	assert.Error(logger.SetRoutes(Routes{LevelInfo: {"unknown"}}))
+
+	assert.NoError(logger.SetRoutes(Routes{
+		LevelInfo:  {Stdout, "audit"},
+		LevelWarn:  {Stderr},
+		LevelError: {"alerts"},
+	}))
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "info")
+	logger.Warn(ctx, LogCatDebug, StatusCatDebug, "warn")
+	logger.Error(ctx, LogCatDebug, StatusCatFailed, "error")
+
+	assert.Equal([]string{"info"}, messages(out.String()))
+	assert.Equal([]string{"info"}, messages(audit.String()))
+	assert.Equal([]string{"warn"}, messages(errOut.String()))
+	assert.Equal([]string{"error"}, messages(alerts.String()))
+}
@@ -0,0 +1,177 @@
+package apilogger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// Sink is an output of a Logger with its own encoder and levels,
+// e.g. a human-readable console at INFO next to a JSON file at
+// DEBUG. Once a sink is added, entries are written to the sinks
+// of the Logger instead of its standard outputs.
+//
+// Entries are filtered by the level and policy of the Logger
+// first, which must let through the entries wanted by the sinks.
+type Sink struct {
+	// Name identifies the sink within its Logger.
+	Name string
+
+	// Writer receives the encoded entries, one Write per entry,
+	// see EntryWriter. It is managed by the caller, Close does
+	// not close it. The writes to a sink are serialized, but
+	// not those to different sinks: a writer shared by several
+	// sinks must be safe for concurrent use.
+	Writer io.Writer
+
+	// Encoder renders the entries, TextEncoder when nil.
+	Encoder Encoder
+
+	// Level is the minimum level of the entries written.
+	Level Level
+
+	// Policy sets the minimum level per LogCat code, overriding
+	// Level, e.g. to keep or drop some categories only.
+	Policy Policy
+}
+
+// EntryWriter is implemented by the writers of sinks that need the
+// entry itself, e.g. to send its fields in their own format, next to
+// its encoding. When the Writer of a sink implements it, WriteEntry
+// is called instead of Write. Neither e nor p may be retained.
+type EntryWriter interface {
+	WriteEntry(e *Entry, p []byte) error
+}
+
+// sink is a Sink added to a Logger.
+type sink struct {
+	Sink
+	policy *compiledPolicy
+
+	// mu serializes the writes to the sink, so a slow
+	// sink only holds up the entries written to it
+	mu sync.Mutex
+}
+
+// enabled reports whether entries of the given
+// level and LogCat are written to the sink.
+func (s *sink) enabled(level Level, logCat LogCat) bool {
+	if min, ok := s.policy.lookup(logCat.Code); ok {
+		return level >= min && min != LevelOff
+	}
+	return level >= s.Level
+}
+
+// WithSink adds a sink to the Logger, see AddSink.
+func WithSink(s Sink) Option {
+	return func(l *Logger) {
+		if err := l.AddSink(s); err != nil {
+			log.Println("Failed to add log sink", err)
+		}
+	}
+}
+
+// AddSink adds a sink to the Logger. Entries are written to
+// its sinks only from then on. It is safe to call while other
+// goroutines are logging.
+func (l *Logger) AddSink(s Sink) error {
+	if s.Name == "" {
+		return errors.New("apilogger: sink without a name")
+	}
+	if s.Writer == nil {
+		return fmt.Errorf("apilogger: sink %q without a writer", s.Name)
+	}
+
+	policy := make(Policy, len(s.Policy))
+	for code, level := range s.Policy {
+		policy[code] = level
+	}
+	s.Policy = policy
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, existing := range l.sinks {
+		if existing.Name == s.Name {
+			return fmt.Errorf("apilogger: sink %q already added", s.Name)
+		}
+	}
+
+	// the slice is replaced, never modified, so
+	// writes can range over it without holding mu
+	sinks := make([]*sink, len(l.sinks), len(l.sinks)+1)
+	copy(sinks, l.sinks)
+	l.sinks = append(sinks, &sink{Sink: s, policy: compilePolicy(policy)})
+	return nil
+}
+
+// RemoveSink removes the sink with the given name and reports
+// whether there was one. Entries are written to the standard
+// outputs again once the last sink is removed.
+func (l *Logger) RemoveSink(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, s := range l.sinks {
+		if s.Name != name {
+			continue
+		}
+		sinks := make([]*sink, 0, len(l.sinks)-1)
+		sinks = append(sinks, l.sinks[:i]...)
+		l.sinks = append(sinks, l.sinks[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// Sinks returns the sinks of the Logger.
+func (l *Logger) Sinks() []Sink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sinks := make([]Sink, 0, len(l.sinks))
+	for _, s := range l.sinks {
+		sinks = append(sinks, s.Sink)
+	}
+	return sinks
+}
+
+// writeSinks encodes the entry for every sink accepting it
+// and writes it to their writers.
+func (l *Logger) writeSinks(sinks []*sink, e *Entry) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+
+	for _, s := range sinks {
+		if !s.enabled(e.Level, e.LogCat) {
+			continue
+		}
+
+		encoder := s.Encoder
+		if encoder == nil {
+			encoder = TextEncoder{}
+		}
+
+		buf.Reset()
+		if err := encoder.Encode(buf, e); err != nil {
+			log.Println("Failed to encode log entry for sink", s.Name, err)
+			continue
+		}
+
+		var err error
+		s.mu.Lock()
+		if ew, ok := s.Writer.(EntryWriter); ok {
+			err = ew.WriteEntry(e, buf.Bytes())
+		} else {
+			_, err = s.Writer.Write(buf.Bytes())
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			log.Println("Failed to write log entry to sink", s.Name, err)
+		}
+	}
+}
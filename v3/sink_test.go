@@ -0,0 +1,105 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+func TestSinks(t *testing.T) {
+	var stdout, console, jsonFile, errorsFile, kafkaFile bytes.Buffer
+	logger := New(
+		WithLevel(LevelDebug),
+		WithSink(Sink{Name: "console", Writer: &console,
+			Policy: Policy{LogCatHealth.Code: LevelOff}}),
+		WithSink(Sink{Name: "json", Writer: &jsonFile, Encoder: JSONEncoder{}, Level: LevelDebug}),
+		WithSink(Sink{Name: "errors", Writer: &errorsFile, Level: LevelError}),
+		WithSink(Sink{Name: "kafka", Writer: &kafkaFile, Encoder: LogfmtEncoder{},
+			Level: LevelOff, Policy: Policy{"KFK*": LevelTrace}}),
+	)
+	logger.output = &stdout
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	logger.Debug(ctx, LogCatKafkaConsume, StatusCatDebug, "consumed")
+	logger.Info(ctx, LogCatHealth, StatusCatPassed, "healthy")
+	logger.Error(ctx, LogCatDebug, StatusCatFailed, "failed")
+	logger.Trace(ctx, LogCatKafkaProduce, StatusCatDebug, "below the logger level")
+
+	assert.Empty(stdout.String())
+	assert.Equal([]string{"failed"}, messages(console.String()))
+	assert.Equal([]string{"failed"}, messages(errorsFile.String()))
+	assert.True(strings.HasPrefix(errorsFile.String(), "ERROR "))
+
+	lines := strings.Split(strings.TrimSpace(jsonFile.String()), "\n")
+	assert.Len(lines, 3)
+	for _, line := range lines {
+		assert.True(json.Valid([]byte(line)), line)
+	}
+
+	assert.Equal(1, strings.Count(kafkaFile.String(), "\n"))
+	assert.True(strings.HasPrefix(kafkaFile.String(), "level=DEBUG "), kafkaFile.String())
+	assert.Contains(kafkaFile.String(), `message=consumed`)
+}
+
+func TestAddAndRemoveSink(t *testing.T) {
+	var stdout, sinkOut bytes.Buffer
+	logger := New()
+	logger.output = &stdout
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	assert.Error(logger.AddSink(Sink{Writer: &sinkOut}))
+	assert.Error(logger.AddSink(Sink{Name: "nowhere"}))
+
+	policy := Policy{LogCatHealth.Code: LevelOff}
+	assert.NoError(logger.AddSink(Sink{Name: "sink", Writer: &sinkOut, Policy: policy}))
+	assert.Error(logger.AddSink(Sink{Name: "sink", Writer: &sinkOut}))
+	// the policy is copied
+	policy[LogCatHealth.Code] = LevelInfo
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "to sink")
+	logger.Info(ctx, LogCatHealth, StatusCatPassed, "dropped")
+	assert.Len(logger.Sinks(), 1)
+
+	assert.True(logger.RemoveSink("sink"))
+	assert.False(logger.RemoveSink("sink"))
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "to stdout")
+
+	assert.Equal([]string{"to sink"}, messages(sinkOut.String()))
+	assert.Equal([]string{"to stdout"}, messages(stdout.String()))
+	assert.Empty(logger.Sinks())
+}
+
+func TestBlockingSink(t *testing.T) {
+	slow := newBlockingWriter()
+	fast := &syncBuffer{}
+	logger := New(
+		WithLevel(LevelDebug),
+		WithSink(Sink{Name: "slow", Writer: slow, Level: LevelError}),
+		WithSink(Sink{Name: "fast", Writer: fast, Level: LevelDebug}),
+	)
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Error(ctx, LogCatDebug, StatusCatFailed, "stuck")
+	}()
+	<-slow.entered
+
+	// neither the other sinks nor the Logger wait for the slow sink
+	logger.Debug(ctx, LogCatDebug, StatusCatDebug, "not stuck")
+	assert := assertion.New(t)
+	assert.Len(logger.Sinks(), 2)
+	assert.Equal([]string{"not stuck"}, messages(fast.String()))
+
+	close(slow.release)
+	<-done
+	assert.Equal([]string{"stuck"}, messages(slow.String()))
+	assert.Equal([]string{"not stuck", "stuck"}, messages(fast.String()))
+}
@@ -0,0 +1,407 @@
+package apilogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Paths of the HTTP Event Collector API.
+const (
+	splunkCollectorPath = "/services/collector"
+	splunkEventPath     = splunkCollectorPath + "/event"
+	splunkAckPath       = splunkCollectorPath + "/ack"
+)
+
+// SplunkConfig configures a SplunkWriter.
+type SplunkConfig struct {
+	// URL of the HTTP Event Collector, the event endpoint path is
+	// added when it has none, e.g. https://splunk:8088. The ack
+	// endpoint is the one next to it, under the same prefix.
+	URL string
+
+	// Token is the HEC token.
+	Token string
+
+	// Host, Source, SourceType and Index are the metadata of the
+	// events. Host is the name of the host when empty, Source
+	// should be the service and SourceType is "apilogger" when
+	// empty. The default index of the token is used when Index
+	// is empty.
+	Host       string
+	Source     string
+	SourceType string
+	Index      string
+
+	// UseAck checks the indexer acknowledgment of every batch and
+	// sends the batch again when it does not come within AckTimeout,
+	// 30s when zero, up to the MaxRetries of Batch. The pending
+	// acknowledgments are polled together in the background every
+	// AckInterval, 1s when zero, so batches are not held back while
+	// waiting for them. The token must have acknowledgment enabled.
+	UseAck      bool
+	AckTimeout  time.Duration
+	AckInterval time.Duration
+
+	// Channel identifies the client to the collector, required
+	// with UseAck. A random one is used when empty.
+	Channel string
+
+	// Client sends the requests, a client with a 10s
+	// timeout when nil.
+	Client *http.Client
+
+	// Batch sets the size of the batches and their retries.
+	Batch BatchConfig
+}
+
+// SplunkWriter is a sink writer sending entries to the Splunk HTTP
+// Event Collector, several events per request. Events hold the keys
+// of a JSONEncoder, and the code, type, status and uuid as indexed
+// fields. Batches refused with a 503, the server being busy, or any
+// other 5xx or 429 status are retried with backoff.
+type SplunkWriter struct {
+	cfg     SplunkConfig
+	url     string
+	ackURL  string
+	batcher *batcher
+
+	// acks holds the batches waiting for their acknowledgment
+	// by ack id, ackCond is signaled once they are checked
+	ackMu    sync.Mutex
+	ackCond  *sync.Cond
+	acks     map[int64]*splunkAck
+	stopAcks chan struct{}
+	acksDone chan struct{}
+}
+
+// splunkAck is a batch waiting for its acknowledgment.
+type splunkAck struct {
+	items    []batchItem
+	deadline time.Time
+	// resent is the number of times the batch was sent again
+	resent int
+}
+
+// NewSplunkWriter returns a SplunkWriter for the config.
+func NewSplunkWriter(cfg SplunkConfig) (*SplunkWriter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("apilogger: invalid splunk url " + strconv.Quote(cfg.URL))
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("apilogger: splunk sink without a token")
+	}
+
+	if cfg.Host == "" {
+		cfg.Host, _ = os.Hostname()
+	}
+	if cfg.SourceType == "" {
+		cfg.SourceType = "apilogger"
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = 30 * time.Second
+	}
+	if cfg.AckInterval <= 0 {
+		cfg.AckInterval = time.Second
+	}
+	if cfg.Channel == "" {
+		cfg.Channel = uuid.New().String()
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	w := &SplunkWriter{cfg: cfg}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = splunkEventPath
+	}
+	w.url = u.String()
+	u.Path = splunkAckURLPath(u.Path)
+	u.RawQuery = url.Values{"channel": {cfg.Channel}}.Encode()
+	w.ackURL = u.String()
+
+	w.batcher = newBatcher(cfg.Batch, w.send)
+	if cfg.UseAck {
+		w.ackCond = sync.NewCond(&w.ackMu)
+		w.acks = make(map[int64]*splunkAck)
+		w.stopAcks = make(chan struct{})
+		w.acksDone = make(chan struct{})
+		go w.pollAcks()
+	}
+	return w, nil
+}
+
+// WriteEntry implements EntryWriter.
+func (w *SplunkWriter) WriteEntry(e *Entry, p []byte) error {
+	var event bytes.Buffer
+	if err := (JSONEncoder{}).Encode(&event, e); err != nil {
+		return err
+	}
+
+	var fields []jsonField
+	for _, f := range []jsonField{
+		{"code", e.LogCat.Code},
+		{"type", e.LogCat.Type},
+		{"status", e.Status.Type},
+		{"uuid", e.Context.UUID},
+	} {
+		if f.value != "" {
+			fields = append(fields, f)
+		}
+	}
+
+	return w.add(e.Time, json.RawMessage(bytes.TrimSuffix(event.Bytes(), []byte("\n"))), fields)
+}
+
+// Write implements io.Writer, sending p as a text event.
+func (w *SplunkWriter) Write(p []byte) (int, error) {
+	if err := w.add(time.Now(), string(bytes.TrimSuffix(p, []byte("\n"))), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *SplunkWriter) add(t time.Time, event interface{}, fields []jsonField) error {
+	hec := []jsonField{
+		{"time", unixSeconds(t)},
+		{"host", w.cfg.Host},
+		{"source", w.cfg.Source},
+		{"sourcetype", w.cfg.SourceType},
+		{"index", w.cfg.Index},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, f := range hec {
+		if f.value == "" {
+			continue
+		}
+		writeJSONValue(&buf, f.key)
+		buf.WriteByte(':')
+		writeJSONValue(&buf, f.value)
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"event":`)
+	writeJSONValue(&buf, event)
+	if len(fields) > 0 {
+		buf.WriteString(`,"fields":`)
+		writeJSONLine(&buf, fields)
+	}
+	buf.WriteByte('}')
+
+	return w.batcher.add(buf.Bytes(), buf.Len())
+}
+
+// Flush sends the current batch and waits until every batch
+// written so far is sent, and acknowledged with UseAck, or dropped.
+func (w *SplunkWriter) Flush() error {
+	w.batcher.flush()
+	w.waitAcks()
+	return nil
+}
+
+// Close sends the current batch, waits for the pending
+// acknowledgments and stops the writer.
+func (w *SplunkWriter) Close() error {
+	if err := w.batcher.close(); err != nil {
+		return err
+	}
+	if w.cfg.UseAck {
+		w.waitAcks()
+		close(w.stopAcks)
+		<-w.acksDone
+	}
+	return nil
+}
+
+// send posts the batch once. With UseAck, its acknowledgment
+// is then checked by pollAcks.
+func (w *SplunkWriter) send(items []batchItem) error {
+	id, err := w.postBatch(items)
+	if err != nil || !w.cfg.UseAck {
+		return err
+	}
+
+	w.ackMu.Lock()
+	w.acks[id] = &splunkAck{items: items, deadline: time.Now().Add(w.cfg.AckTimeout)}
+	w.ackMu.Unlock()
+	return nil
+}
+
+// postBatch posts the batch and returns its ack id with UseAck.
+func (w *SplunkWriter) postBatch(items []batchItem) (int64, error) {
+	var body bytes.Buffer
+	for _, item := range items {
+		body.Write(item.value.([]byte))
+	}
+
+	resp, err := w.post(w.url, &body)
+	if err != nil || !w.cfg.UseAck {
+		return 0, err
+	}
+
+	var result struct {
+		AckID *int64 `json:"ackId"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil || result.AckID == nil {
+		return 0, permanent(errors.New("apilogger: splunk acknowledgment is not enabled for the token"))
+	}
+	return *result.AckID, nil
+}
+
+// pollAcks checks the pending acknowledgments every
+// AckInterval until the writer is closed.
+func (w *SplunkWriter) pollAcks() {
+	defer close(w.acksDone)
+
+	ticker := time.NewTicker(w.cfg.AckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopAcks:
+			return
+		case <-ticker.C:
+			w.checkAcks()
+		}
+	}
+}
+
+// checkAcks polls the pending acknowledgments in a single request,
+// and sends again the batches not acknowledged within AckTimeout.
+func (w *SplunkWriter) checkAcks() {
+	w.ackMu.Lock()
+	ids := make([]int64, 0, len(w.acks))
+	for id := range w.acks {
+		ids = append(ids, id)
+	}
+	w.ackMu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	acked := w.queryAcks(ids)
+	now := time.Now()
+
+	w.ackMu.Lock()
+	var expired []int64
+	for _, id := range ids {
+		if acked[id] {
+			delete(w.acks, id)
+		} else if now.After(w.acks[id].deadline) {
+			expired = append(expired, id)
+		}
+	}
+	w.ackMu.Unlock()
+
+	// the expired batches stay pending until sent again,
+	// so Flush does not return in between
+	for _, id := range expired {
+		w.resend(id)
+	}
+
+	w.ackMu.Lock()
+	w.ackCond.Broadcast()
+	w.ackMu.Unlock()
+}
+
+// queryAcks returns the acknowledged ids among ids,
+// none when the query fails.
+func (w *SplunkWriter) queryAcks(ids []int64) map[int64]bool {
+	query, _ := json.Marshal(map[string][]int64{"acks": ids})
+	resp, err := w.post(w.ackURL, bytes.NewBuffer(query))
+	if err != nil {
+		return nil
+	}
+
+	var result struct {
+		Acks map[string]bool `json:"acks"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil
+	}
+	acked := make(map[int64]bool, len(result.Acks))
+	for k, ok := range result.Acks {
+		if id, err := strconv.ParseInt(k, 10, 64); err == nil && ok {
+			acked[id] = true
+		}
+	}
+	return acked
+}
+
+// resend sends the batch of an expired acknowledgment again, or
+// reports it as lost once it was sent MaxRetries times already.
+func (w *SplunkWriter) resend(id int64) {
+	w.ackMu.Lock()
+	ack := w.acks[id]
+	w.ackMu.Unlock()
+
+	err := fmt.Errorf("apilogger: splunk did not acknowledge batch %d", id)
+	var newID int64
+	if ack.resent < w.batcher.cfg.MaxRetries {
+		newID, err = w.postBatch(ack.items)
+	}
+
+	w.ackMu.Lock()
+	delete(w.acks, id)
+	if err == nil {
+		w.acks[newID] = &splunkAck{
+			items:    ack.items,
+			deadline: time.Now().Add(w.cfg.AckTimeout),
+			resent:   ack.resent + 1,
+		}
+	}
+	w.ackMu.Unlock()
+
+	if err != nil {
+		w.batcher.lost(err, len(ack.items))
+	}
+}
+
+// waitAcks waits until no acknowledgment is pending.
+func (w *SplunkWriter) waitAcks() {
+	if !w.cfg.UseAck {
+		return
+	}
+
+	w.ackMu.Lock()
+	defer w.ackMu.Unlock()
+	for len(w.acks) > 0 {
+		w.ackCond.Wait()
+	}
+}
+
+// post sends a request to the collector and returns the response body.
+func (w *SplunkWriter) post(endpoint string, body *bytes.Buffer) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	req.Header.Set("Authorization", "Splunk "+w.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Splunk-Request-Channel", w.cfg.Channel)
+
+	return doBatchRequest(w.cfg.Client, req)
+}
+
+// splunkAckURLPath returns the path of the ack endpoint next to the
+// event endpoint at eventPath, keeping the prefix of a collector
+// behind a proxy, e.g. /splunk/services/collector/ack for
+// /splunk/services/collector/event.
+func splunkAckURLPath(eventPath string) string {
+	if i := strings.LastIndex(eventPath, splunkCollectorPath); i >= 0 {
+		return eventPath[:i] + splunkAckPath
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(eventPath, "/"), "/event") + "/ack"
+}
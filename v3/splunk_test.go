@@ -0,0 +1,276 @@
+package apilogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// fakeHEC is a stub HTTP Event Collector recording the events
+// it receives and acknowledging them when acks are enabled.
+type fakeHEC struct {
+	mu       sync.Mutex
+	events   []map[string]interface{}
+	requests int
+	channels []string
+	// busy is the number of event requests to refuse with a 503
+	busy int
+	// acks enables acknowledgments, pending holds the batches not
+	// acknowledged yet and lost those that never will be
+	acks    bool
+	polls   int
+	nextAck int64
+	pending map[int64]int
+	lost    map[int64]bool
+}
+
+func (f *fakeHEC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Splunk token" {
+		http.Error(w, `{"text":"Invalid token","code":4}`, http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case splunkEventPath:
+		f.requests++
+		if f.busy > 0 {
+			f.busy--
+			http.Error(w, `{"text":"Server is busy","code":9}`, http.StatusServiceUnavailable)
+			return
+		}
+		f.channels = append(f.channels, r.Header.Get("X-Splunk-Request-Channel"))
+
+		var events []map[string]interface{}
+		dec := json.NewDecoder(r.Body)
+		for {
+			var event map[string]interface{}
+			if err := dec.Decode(&event); err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, `{"text":"Invalid data format","code":6}`, http.StatusBadRequest)
+				return
+			}
+			events = append(events, event)
+		}
+
+		if !f.acks {
+			f.events = append(f.events, events...)
+			fmt.Fprint(w, `{"text":"Success","code":0}`)
+			return
+		}
+		id := f.nextAck
+		f.nextAck++
+		if f.lost[id] {
+			// the indexer never acknowledges this batch
+			fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, id)
+			return
+		}
+		f.events = append(f.events, events...)
+		// acknowledged at the second poll
+		f.pending[id] = 2
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, id)
+
+	case splunkAckPath:
+		f.polls++
+		if r.URL.Query().Get("channel") != r.Header.Get("X-Splunk-Request-Channel") {
+			http.Error(w, `{"text":"Invalid channel","code":11}`, http.StatusBadRequest)
+			return
+		}
+		var query struct {
+			Acks []int64 `json:"acks"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&query)
+
+		acks := make(map[string]bool)
+		for _, id := range query.Acks {
+			if polls, ok := f.pending[id]; ok {
+				f.pending[id] = polls - 1
+				acks[strconv.FormatInt(id, 10)] = polls <= 1
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"acks": acks})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeHEC) received() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.events...)
+}
+
+func TestSplunkWriter(t *testing.T) {
+	f := &fakeHEC{busy: 2}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	w, err := NewSplunkWriter(SplunkConfig{
+		URL:    server.URL,
+		Token:  "token",
+		Host:   "web-1",
+		Source: "billing",
+		Index:  "main",
+		Batch:  fastRetries,
+	})
+	assertion.NoError(t, err)
+
+	logger := New(WithSink(Sink{Name: "splunk", Writer: w}))
+	ctx := context.WithValue(context.Background(), ContextData, CtxKeys{UUID: "12345zw"})
+	logger.Info(ctx, LogCatCSV, StatusCatPassed, "imported")
+	logger.WarnWF(ctx, LogCatSMTP, StatusCatPending, &Fields{"attempts": 2})
+	_, err = w.Write([]byte("plain\n"))
+	assertion.NoError(t, err)
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	events := f.received()
+	if !assert.Len(events, 3) {
+		return
+	}
+	// the batch is sent in one request, after two 503 responses
+	assert.Equal(3, f.requests)
+
+	first := events[0]
+	assert.Equal("web-1", first["host"])
+	assert.Equal("billing", first["source"])
+	assert.Equal("apilogger", first["sourcetype"])
+	assert.Equal("main", first["index"])
+	assert.InDelta(float64(time.Now().Unix()), first["time"], 60)
+	assert.Equal(map[string]interface{}{
+		"code": LogCatCSV.Code, "type": LogCatCSV.Type, "status": "Passed", "uuid": "12345zw",
+	}, first["fields"])
+
+	event := first["event"].(map[string]interface{})
+	assert.Equal("imported", event["message"])
+	assert.Equal("INFO", event["level"])
+	assert.Equal(float64(2), events[1]["event"].(map[string]interface{})["attempts"])
+	assert.Equal("plain", events[2]["event"])
+	assert.NotContains(events[2], "fields")
+}
+
+func TestSplunkWriterAcks(t *testing.T) {
+	f := &fakeHEC{acks: true, pending: map[int64]int{}, lost: map[int64]bool{0: true}}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	w, err := NewSplunkWriter(SplunkConfig{
+		URL:         server.URL + "/",
+		Token:       "token",
+		UseAck:      true,
+		AckTimeout:  20 * time.Millisecond,
+		AckInterval: 5 * time.Millisecond,
+		Batch:       fastRetries,
+	})
+	assertion.NoError(t, err)
+
+	_, _ = w.Write([]byte("acknowledged\n"))
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	// the first batch was never acknowledged, so it was sent again
+	assert.Equal(2, f.requests)
+	if assert.Len(f.received(), 1) {
+		assert.Equal("acknowledged", f.received()[0]["event"])
+	}
+	assert.Equal(0, f.pending[1])
+	assert.NotEmpty(f.channels[0])
+	assert.Equal(f.channels[0], f.channels[1])
+}
+
+func TestSplunkWriterAcksDoNotHoldBatches(t *testing.T) {
+	f := &fakeHEC{acks: true, pending: map[int64]int{}}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	batch := fastRetries
+	batch.MaxEntries = 1
+	w, err := NewSplunkWriter(SplunkConfig{
+		URL:         server.URL,
+		Token:       "token",
+		UseAck:      true,
+		AckInterval: time.Hour,
+		Batch:       batch,
+	})
+	assertion.NoError(t, err)
+
+	// the batches are sent while the first one is not acknowledged
+	for i := 0; i < 5; i++ {
+		_, _ = w.Write([]byte("event\n"))
+	}
+	assert := assertion.New(t)
+	assert.Eventually(func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.requests == 5
+	}, time.Second, 5*time.Millisecond)
+
+	w.ackMu.Lock()
+	assert.Len(w.acks, 5)
+	w.ackMu.Unlock()
+
+	// a single request polls all of them
+	w.checkAcks()
+	w.checkAcks()
+	w.ackMu.Lock()
+	assert.Empty(w.acks)
+	w.ackMu.Unlock()
+	assert.Equal(2, f.polls)
+	assert.NoError(w.Close())
+}
+
+func TestSplunkWriterErrors(t *testing.T) {
+	f := &fakeHEC{}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	var lost int
+	batch := fastRetries
+	batch.OnError = func(err error, entries int) { lost += entries }
+	w, err := NewSplunkWriter(SplunkConfig{URL: server.URL, Token: "wrong", Batch: batch})
+	assertion.NoError(t, err)
+
+	_, _ = w.Write([]byte("refused\n"))
+	assertion.NoError(t, w.Close())
+
+	assert := assertion.New(t)
+	assert.Equal(1, lost)
+	assert.Equal(0, f.requests)
+
+	_, err = NewSplunkWriter(SplunkConfig{URL: server.URL})
+	assert.Error(err)
+	_, err = NewSplunkWriter(SplunkConfig{Token: "token"})
+	assert.Error(err)
+}
+
+func TestSplunkAckURL(t *testing.T) {
+	assert := assertion.New(t)
+	for event, ack := range map[string]string{
+		"https://splunk:8088":                              "https://splunk:8088/services/collector/ack?channel=c1",
+		"https://splunk:8088/services/collector":           "https://splunk:8088/services/collector/ack?channel=c1",
+		"https://splunk:8088/services/collector/event/1.0": "https://splunk:8088/services/collector/ack?channel=c1",
+		"https://proxy/splunk/services/collector/event":    "https://proxy/splunk/services/collector/ack?channel=c1",
+		"https://proxy/hec/event":                          "https://proxy/hec/ack?channel=c1",
+		"https://proxy/hec/":                               "https://proxy/hec/ack?channel=c1",
+	} {
+		w, err := NewSplunkWriter(SplunkConfig{URL: event, Token: "token", Channel: "c1"})
+		if !assert.NoError(err, event) {
+			continue
+		}
+		assert.Equal(ack, w.ackURL, event)
+		assert.NoError(w.Close())
+	}
+}
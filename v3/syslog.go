@@ -0,0 +1,319 @@
+package apilogger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SyslogFacility is the facility of syslog messages.
+type SyslogFacility int
+
+// Syslog facilities, see RFC 5424 section 6.2.1.
+const (
+	FacilityUser   SyslogFacility = 1
+	FacilityMail   SyslogFacility = 2
+	FacilityDaemon SyslogFacility = 3
+	FacilityAuth   SyslogFacility = 4
+	FacilityCron   SyslogFacility = 9
+	FacilityLocal0 SyslogFacility = 16
+	FacilityLocal1 SyslogFacility = 17
+	FacilityLocal2 SyslogFacility = 18
+	FacilityLocal3 SyslogFacility = 19
+	FacilityLocal4 SyslogFacility = 20
+	FacilityLocal5 SyslogFacility = 21
+	FacilityLocal6 SyslogFacility = 22
+	FacilityLocal7 SyslogFacility = 23
+)
+
+// errWriterClosed is returned when using a closed network writer.
+var errWriterClosed = errors.New("apilogger: writer already closed")
+
+// syslogTimeFormat is the TIMESTAMP layout of RFC 5424.
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogSDID is the default SD-ID of the structured data,
+// under the enterprise number reserved for documentation.
+const syslogSDID = "apilogger@32473"
+
+// SyslogEncoder renders entries as RFC 5424 syslog messages, the
+// LogCat code as MSGID and the uuid, task name, type, status and
+// location as structured data, with the trace context of entries
+// logged in a span. The message, or the fields of WF entries as
+// logfmt pairs, is the MSG part.
+//
+//	<14>1 2024-09-23T11:29:55.120000-04:00 host task 42 DBG001 [apilogger@32473 uuid="20d989f8" taskName="Task-Name" type="debug" status="Debug" location="main.go:19"] This is an info message
+type SyslogEncoder struct {
+	// Facility of the messages, FacilityUser when zero.
+	Facility SyslogFacility
+
+	// Hostname is the HOSTNAME of the messages,
+	// the name of the host when empty.
+	Hostname string
+
+	// AppName is the APP-NAME of the messages,
+	// the name of the executable when empty.
+	AppName string
+
+	// SDID is the SD-ID of the structured data,
+	// apilogger@32473 when empty.
+	SDID string
+}
+
+var (
+	syslogHostOnce sync.Once
+	syslogHost     string
+)
+
+// syslogSeverity returns the syslog severity of the level.
+func syslogSeverity(level Level) int {
+	switch {
+	case level >= LevelFatal:
+		return 2 // critical
+	case level >= LevelError:
+		return 3 // error
+	case level >= LevelWarn:
+		return 4 // warning
+	case level >= LevelInfo:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// Encode implements Encoder.
+func (s SyslogEncoder) Encode(w io.Writer, e *Entry) error {
+	facility := s.Facility
+	if facility == 0 {
+		facility = FacilityUser
+	}
+
+	hostname := s.Hostname
+	if hostname == "" {
+		syslogHostOnce.Do(func() {
+			syslogHost, _ = os.Hostname()
+		})
+		hostname = syslogHost
+	}
+
+	appName := s.AppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+
+	sdID := s.SDID
+	if sdID == "" {
+		sdID = syslogSDID
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(int(facility)*8 + syslogSeverity(e.Level)))
+	buf.WriteString(">1 ")
+	buf.WriteString(e.Time.Format(syslogTimeFormat))
+	buf.WriteByte(' ')
+	buf.WriteString(syslogHeaderField(hostname, 255))
+	buf.WriteByte(' ')
+	buf.WriteString(syslogHeaderField(appName, 48))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(os.Getpid()))
+	buf.WriteByte(' ')
+	buf.WriteString(syslogHeaderField(e.LogCat.Code, 32))
+	buf.WriteByte(' ')
+	writeSyslogSD(&buf, syslogHeaderField(sdID, 32), append([]jsonField{
+		{"uuid", e.Context.UUID},
+		{"taskName", e.Context.TaskName},
+		{"type", e.LogCat.Type},
+		{"status", e.Status.Type},
+		{"location", e.Caller.Location()},
+	}, traceFields(e)...))
+
+	msg := e.Message
+	if e.Fields != nil {
+		msg = logfmtFields(e.Fields)
+	}
+	if msg != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeSyslogSD writes the non empty params as one SD-ELEMENT,
+// or the NILVALUE when all of them are empty.
+func writeSyslogSD(buf *bytes.Buffer, id string, params []jsonField) {
+	written := false
+	for _, p := range params {
+		value, _ := p.value.(string)
+		if value == "" {
+			continue
+		}
+		if !written {
+			buf.WriteByte('[')
+			buf.WriteString(id)
+			written = true
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(p.key)
+		buf.WriteString(`="`)
+		for _, r := range value {
+			// characters that must be escaped in PARAM-VALUE
+			if r == '"' || r == '\\' || r == ']' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteRune(r)
+		}
+		buf.WriteByte('"')
+	}
+
+	if !written {
+		buf.WriteByte('-')
+		return
+	}
+	buf.WriteByte(']')
+}
+
+// syslogHeaderField returns v as a header field of at most max
+// printable ASCII characters, or the NILVALUE when it is empty.
+func syslogHeaderField(v string, max int) string {
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, v)
+
+	if v == "" {
+		return "-"
+	}
+	if len(v) > max {
+		v = v[:max]
+	}
+	return v
+}
+
+// SyslogWriter sends the messages of a SyslogEncoder to a syslog
+// server, one message per Write. Over UDP and datagram Unix sockets
+// every message is a datagram, over TCP and stream Unix sockets
+// messages are framed with octet counting (RFC 6587). It reconnects
+// when a write fails and is safe for concurrent use.
+type SyslogWriter struct {
+	network string
+	addr    string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+	closed bool
+}
+
+// DialSyslog connects to the syslog server at addr. The network is
+// "udp", "tcp" (or their 4/6 variants), "unixgram" or "unix". A
+// "unix" address is dialed as a datagram socket first, like /dev/log,
+// then as a stream socket.
+func DialSyslog(network, addr string) (*SyslogWriter, error) {
+	w := &SyslogWriter{network: network, addr: addr}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect (re)establishes the connection. It must be called with mu held.
+func (w *SyslogWriter) connect() error {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	network := w.network
+	if network == "unix" {
+		if conn, err := net.Dial("unixgram", w.addr); err == nil {
+			w.conn, w.stream = conn, false
+			return nil
+		}
+	}
+
+	conn, err := net.Dial(network, w.addr)
+	if err != nil {
+		return err
+	}
+
+	w.conn = conn
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		w.stream = true
+	default:
+		w.stream = false
+	}
+	return nil
+}
+
+// Write implements io.Writer, sending p as one message without
+// its trailing newline.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	err := w.send(msg)
+	if err != nil {
+		// the server may have restarted, retry once
+		if err = w.connect(); err == nil {
+			err = w.send(msg)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send writes the message. It must be called with mu held.
+func (w *SyslogWriter) send(msg []byte) error {
+	if w.conn == nil {
+		return fmt.Errorf("apilogger: not connected to syslog at %s", w.addr)
+	}
+
+	if w.stream {
+		frame := make([]byte, 0, len(msg)+8)
+		frame = strconv.AppendInt(frame, int64(len(msg)), 10)
+		frame = append(frame, ' ')
+		msg = append(frame, msg...)
+	}
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,207 @@
+package apilogger
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+// syslogPattern matches the RFC 5424 messages of SyslogEncoder.
+var syslogPattern = regexp.MustCompile(
+	`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) (\S+) (-|\[.*\])(?: (.*))?$`)
+
+func TestSyslogEncoder(t *testing.T) {
+	e := testEntry(LogCatStartUp)
+	e.Level = LevelWarn
+	e.Message = "hello test"
+	e.Context.TaskName = `Update "Password"]`
+
+	var buf strings.Builder
+	encoder := SyslogEncoder{Facility: FacilityLocal0, Hostname: "batch host", AppName: "task"}
+	assertion.NoError(t, encoder.Encode(&buf, e))
+	assert := assertion.New(t)
+
+	output := buf.String()
+	assert.True(strings.HasSuffix(output, "\n"))
+	match := syslogPattern.FindStringSubmatch(strings.TrimSuffix(output, "\n"))
+	if !assert.NotNil(match, output) {
+		return
+	}
+
+	assert.Equal(strconv.Itoa(16*8+4), match[1])
+	_, err := time.Parse(syslogTimeFormat, match[2])
+	assert.NoError(err)
+	assert.Equal("batch_host", match[3])
+	assert.Equal("task", match[4])
+	assert.Equal(strconv.Itoa(os.Getpid()), match[5])
+	assert.Equal(LogCatStartUp.Code, match[6])
+	assert.Equal(`[apilogger@32473 uuid="12345zw" taskName="Update \"Password\"\]" `+
+		`type="service_startup" status="Pending" location="`+e.Caller.Location()+`"]`, match[7])
+	assert.Equal("hello test", match[8])
+
+	e.Fields = Fields{"step": 1, "name": "a b"}
+	e.Context = CtxKeys{}
+	e.Status = StatusCat{}
+	e.Caller = Caller{}
+	e.LogCat = LogCat{}
+	buf.Reset()
+	assert.NoError(SyslogEncoder{}.Encode(&buf, e))
+	match = syslogPattern.FindStringSubmatch(strings.TrimSuffix(buf.String(), "\n"))
+	if assert.NotNil(match, buf.String()) {
+		assert.Equal(strconv.Itoa(1*8+4), match[1])
+		assert.Equal("-", match[6])
+		assert.Equal(`[apilogger@32473 location=":0"]`, match[7])
+		assert.Equal(`name="a b" step=1`, match[8])
+	}
+}
+
+func TestSyslogSeverities(t *testing.T) {
+	expected := map[Level]int{
+		LevelTrace: 7, LevelDebug: 7, LevelInfo: 6,
+		LevelWarn: 4, LevelError: 3, LevelFatal: 2,
+	}
+	for level, severity := range expected {
+		assertion.Equal(t, severity, syslogSeverity(level), level.String())
+	}
+}
+
+// syslogLogger returns a Logger writing to a syslog sink
+// connected to the given local listener.
+func syslogLogger(t *testing.T, network, addr string) (*Logger, *SyslogWriter) {
+	w, err := DialSyslog(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+
+	logger := New(WithSink(Sink{Name: "syslog", Writer: w, Encoder: SyslogEncoder{AppName: "test"}}))
+	return logger, w
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger, _ := syslogLogger(t, "udp", conn.LocalAddr().String())
+	ctx := NewContextLogger(context.Background(), "syslog")
+	logger.Error(ctx, LogCatDebug, StatusCatFailed, "over udp")
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert := assertion.New(t)
+	assert.NoError(err)
+
+	match := syslogPattern.FindStringSubmatch(string(buf[:n]))
+	if assert.NotNil(match, string(buf[:n])) {
+		assert.Equal("11", match[1])
+		assert.Equal(LogCatDebug.Code, match[6])
+		assert.Contains(match[7], `taskName="syslog"`)
+		assert.Equal("over udp", match[8])
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go readOctetCounted(conn, messages)
+		}
+	}()
+
+	logger, w := syslogLogger(t, "tcp", ln.Addr().String())
+	ctx := context.Background()
+	assert := assertion.New(t)
+
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "first\nwith a newline")
+	logger.Warn(ctx, LogCatDebug, StatusCatDebug, "second")
+
+	// the writer reconnects once the connection is lost
+	w.mu.Lock()
+	w.conn.Close()
+	w.mu.Unlock()
+	logger.Info(ctx, LogCatDebug, StatusCatDebug, "after reconnect")
+
+	// the messages of the two connections are read concurrently
+	var received []string
+	for len(received) < 3 {
+		select {
+		case msg := <-messages:
+			match := syslogPattern.FindStringSubmatch(strings.Replace(msg, "\n", " ", -1))
+			if assert.NotNil(match, msg) {
+				received = append(received, match[8])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d messages received", len(received))
+		}
+	}
+	assert.ElementsMatch([]string{"first with a newline", "second", "after reconnect"}, received)
+
+	assert.NoError(w.Close())
+	_, err = w.Write([]byte("closed\n"))
+	assert.Error(err)
+}
+
+// readOctetCounted reads RFC 6587 octet counted messages.
+func readOctetCounted(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+		messages <- string(msg)
+	}
+}
+
+func TestSyslogUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unix datagram sockets are not supported:", err)
+	}
+	defer conn.Close()
+
+	logger, _ := syslogLogger(t, "unix", path)
+	logger.Info(context.Background(), LogCatDebug, StatusCatDebug, "over unix")
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assertion.NoError(t, err)
+	assertion.Regexp(t, syslogPattern, string(buf[:n]))
+	assertion.True(t, strings.HasSuffix(string(buf[:n]), " over unix"))
+}
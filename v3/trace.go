@@ -0,0 +1,175 @@
+package apilogger
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// TraceContext identifies the span an entry is logged in, as
+// propagated by the W3C Trace Context traceparent header.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+
+	// Flags are the trace flags, the lowest bit
+	// being set when the trace is sampled
+	Flags byte
+}
+
+// traceContextKey is the context key of the
+// trace context set by WithTraceContext.
+const traceContextKey ContextKey = "trace-context"
+
+// IsValid reports whether both the trace and span ids are set.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// Sampled reports whether the sampled flag is set.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&1 == 1
+}
+
+// TraceIDString returns the trace id as 32 lowercase hex digits.
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString returns the span id as 16 lowercase hex digits.
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// FlagsString returns the trace flags as 2 lowercase hex digits.
+func (tc TraceContext) FlagsString() string {
+	return hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Traceparent returns the trace context as a version 00
+// traceparent value, e.g.
+//
+//	00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (tc TraceContext) Traceparent() string {
+	return "00-" + tc.TraceIDString() + "-" + tc.SpanIDString() + "-" + tc.FlagsString()
+}
+
+// ParseTraceparent parses a traceparent header value. Values of a
+// later version than 00 are accepted as long as they start with the
+// fields of version 00, as the recommendation requires.
+func ParseTraceparent(s string) (TraceContext, error) {
+	var tc TraceContext
+	invalid := errors.New("apilogger: invalid traceparent " + strconv.Quote(s))
+
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return tc, invalid
+	}
+	version, ok := parseLowerHex(s[:2], 1)
+	if !ok || version[0] == 0xff {
+		return tc, invalid
+	}
+	if len(s) > 55 && (version[0] == 0 || s[55] != '-') {
+		return tc, invalid
+	}
+
+	traceID, ok := parseLowerHex(s[3:35], 16)
+	if !ok {
+		return tc, invalid
+	}
+	spanID, ok := parseLowerHex(s[36:52], 8)
+	if !ok {
+		return tc, invalid
+	}
+	flags, ok := parseLowerHex(s[53:55], 1)
+	if !ok {
+		return tc, invalid
+	}
+
+	copy(tc.TraceID[:], traceID)
+	copy(tc.SpanID[:], spanID)
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return TraceContext{}, invalid
+	}
+	return tc, nil
+}
+
+// parseLowerHex decodes s, n bytes written with lowercase hex digits.
+func parseLowerHex(s string, n int) ([]byte, bool) {
+	if len(s) != 2*n {
+		return nil, false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// WithTraceContext returns a copy of ctx carrying tc, which the
+// entries logged with the context are correlated to.
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey, tc)
+}
+
+// WithTraceparent returns a copy of ctx carrying the trace context
+// of a traceparent header value, or ctx and an error when the value
+// is invalid.
+func WithTraceparent(ctx context.Context, traceparent string) (context.Context, error) {
+	tc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx, err
+	}
+	return WithTraceContext(ctx, tc), nil
+}
+
+// TraceContextFrom returns the trace context set
+// on ctx by WithTraceContext or WithTraceparent.
+func TraceContextFrom(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// TraceExtractor returns the trace context of the span active
+// in ctx, to correlate entries with the spans of a tracing
+// library such as OpenTelemetry.
+type TraceExtractor func(ctx context.Context) (TraceContext, bool)
+
+// SpanEventRecorder records an entry as an event of the span
+// active in ctx. It is called synchronously by the log call,
+// while the span is still recording, and must neither modify
+// nor retain the entry.
+type SpanEventRecorder func(ctx context.Context, e *Entry)
+
+// WithTraceExtractor sets the function returning the trace context
+// of the entries. The trace context set by WithTraceContext is used
+// when it returns false.
+func WithTraceExtractor(extract TraceExtractor) Option {
+	return func(l *Logger) {
+		l.traceExtractor = extract
+	}
+}
+
+// WithSpanEvents records every entry written with
+// a trace context as an event of its span.
+func WithSpanEvents(record SpanEventRecorder) Option {
+	return func(l *Logger) {
+		l.spanEvents = record
+	}
+}
+
+// traceFields returns the trace_id, span_id and trace_flags
+// keys of the entry, or nil when it has no trace context.
+func traceFields(e *Entry) []jsonField {
+	if !e.Trace.IsValid() {
+		return nil
+	}
+	return []jsonField{
+		{"trace_id", e.Trace.TraceIDString()},
+		{"span_id", e.Trace.SpanIDString()},
+		{"trace_flags", e.Trace.FlagsString()},
+	}
+}
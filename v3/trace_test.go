@@ -0,0 +1,144 @@
+package apilogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	assertion "github.com/stretchr/testify/assert"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	assert := assertion.New(t)
+
+	tc, err := ParseTraceparent(testTraceparent)
+	assert.NoError(err)
+	assert.True(tc.IsValid())
+	assert.True(tc.Sampled())
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceIDString())
+	assert.Equal("00f067aa0ba902b7", tc.SpanIDString())
+	assert.Equal("01", tc.FlagsString())
+	assert.Equal(testTraceparent, tc.Traceparent())
+
+	// later versions may add fields
+	tc, err = ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.NoError(err)
+	assert.False(tc.Sampled())
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		assert.Error(err, invalid)
+	}
+}
+
+func TestTraceContextFrom(t *testing.T) {
+	assert := assertion.New(t)
+
+	_, ok := TraceContextFrom(context.Background())
+	assert.False(ok)
+
+	ctx, err := WithTraceparent(context.Background(), testTraceparent)
+	assert.NoError(err)
+	tc, ok := TraceContextFrom(ctx)
+	assert.True(ok)
+	assert.Equal(testTraceparent, tc.Traceparent())
+
+	same, err := WithTraceparent(ctx, "invalid")
+	assert.Error(err)
+	assert.Equal(ctx, same)
+
+	_, ok = TraceContextFrom(WithTraceContext(context.Background(), TraceContext{Flags: 1}))
+	assert.False(ok)
+}
+
+func TestLoggerTraceContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(WithEncoder(JSONEncoder{}))
+	logger.output = &buf
+
+	ctx, _ := WithTraceparent(context.Background(), testTraceparent)
+	logger.Info(ctx, LogCatDebug, StatusCatPassed, "traced")
+	logger.Info(context.Background(), LogCatDebug, StatusCatPassed, "untraced")
+
+	assert := assertion.New(t)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(lines, 2) {
+		return
+	}
+
+	var traced, untraced map[string]interface{}
+	assert.NoError(json.Unmarshal([]byte(lines[0]), &traced))
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &untraced))
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", traced["trace_id"])
+	assert.Equal("00f067aa0ba902b7", traced["span_id"])
+	assert.Equal("01", traced["trace_flags"])
+	assert.NotContains(untraced, "trace_id")
+	assert.NotContains(untraced, "span_id")
+}
+
+func TestLoggerTraceExtractor(t *testing.T) {
+	type spanKey struct{}
+	span := TraceContext{TraceID: [16]byte{1}, SpanID: [8]byte{2}, Flags: 1}
+
+	var events []string
+	var buf bytes.Buffer
+	logger := New(
+		WithEncoder(LogfmtEncoder{}),
+		WithTraceExtractor(func(ctx context.Context) (TraceContext, bool) {
+			tc, ok := ctx.Value(spanKey{}).(TraceContext)
+			return tc, ok
+		}),
+		WithSpanEvents(func(ctx context.Context, e *Entry) {
+			events = append(events, e.Trace.SpanIDString()+" "+e.Message)
+		}),
+	)
+	logger.output = &buf
+
+	stored, _ := WithTraceparent(context.Background(), testTraceparent)
+	logger.Info(context.WithValue(stored, spanKey{}, span), LogCatDebug, StatusCatPassed, "active span")
+	logger.Info(stored, LogCatDebug, StatusCatPassed, "stored")
+	logger.Info(context.Background(), LogCatDebug, StatusCatPassed, "no span")
+	logger.InfoWF(stored, LogCatDebug, StatusCatPassed, &Fields{"trace_id": "shadowed"})
+
+	assert := assertion.New(t)
+	assert.Equal([]string{
+		"0200000000000000 active span",
+		"00f067aa0ba902b7 stored",
+		"00f067aa0ba902b7 ",
+	}, events)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(lines, 4) {
+		return
+	}
+	assert.Contains(lines[0], "trace_id=01000000000000000000000000000000 span_id=0200000000000000 trace_flags=01")
+	assert.Contains(lines[1], "trace_id=4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.NotContains(lines[2], "trace_id")
+	assert.Contains(lines[3], "fields.trace_id=shadowed")
+}
+
+func TestTextEncoderTraceContext(t *testing.T) {
+	e := testEntry(LogCatDebug)
+	assert := assertion.New(t)
+	assert.NotContains(textMessage(t, e), "trace_id")
+
+	e.Trace, _ = ParseTraceparent(testTraceparent)
+	e.Fields = Fields{"span_id": "shadowed"}
+	line := textMessage(t, e)
+	assert.Contains(line, `, trace_id="4bf92f3577b34da6a3ce929d0e0e4736", span_id="00f067aa0ba902b7", trace_flags="01"`)
+	assert.Contains(line, `fields.span_id="shadowed"`)
+}